@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/zx2/code-checker/pkg/api"
@@ -13,8 +17,17 @@ import (
 
 func main() {
 	var configFile = flag.String("config", "config.json", "配置文件路径")
+	var retryFailed = flag.Bool("retry-failed", false, "只重新执行输出目录中failures.json记录的失败任务")
+	var dryRun = flag.Bool("dry-run", false, "只规划任务并估算请求数、token数和费用，写入输出目录的plan.json，不调用API")
+	flag.Usage = usage
 	flag.Parse()
 
+	// providers 子命令：列出支持的AI服务提供商
+	if flag.Arg(0) == "providers" {
+		printProviders()
+		return
+	}
+
 	// 加载配置文件
 	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
@@ -23,24 +36,42 @@ func main() {
 	}
 
 	// 创建API客户端
-	var apiClient api.AIClient
-	switch cfg.API.Type {
-	case "siliconflow":
-		apiClient = &api.SiliconflowClient{}
-	case "openai":
-		apiClient = &api.OpenAIClient{}
-	case "aihubmix":
-		apiClient = &api.AiHubMixClient{}
-	case "volcengine":
-		apiClient = &api.VolcEngineClient{}
-	default:
-		fmt.Printf("不支持的API类型: %s\n", cfg.API.Type)
+	apiClient, err := api.NewClient(cfg.API.Type)
+	if err != nil {
+		fmt.Printf("创建API客户端失败: %v\n", err)
 		os.Exit(1)
 	}
 
+	// 配置了其他鉴权方式时替换默认的api.key鉴权
+	if cfg.API.Auth.Type == config.AuthVolcSign {
+		apiClient.SetAuthenticator(api.NewVolcKeyAuth(cfg.API.Auth.AccessKey, cfg.API.Auth.SecretKey, cfg.API.Auth.Region, cfg.API.Model))
+	}
+
 	// 设置日志开关
 	apiClient.SetLogFile(cfg.API.EnableLog)
 
+	// 设置是否使用结构化输出以及代码是否带行号
+	apiClient.SetStructuredOutput(cfg.API.StructuredOutput)
+	apiClient.SetLineNumbers(cfg.Check.LineNumbers)
+	if cacher, ok := apiClient.(api.PromptCacher); ok {
+		cacher.SetPromptCache(cfg.API.PromptCache)
+	} else if cfg.API.PromptCache {
+		fmt.Printf("警告: %s 不支持显式提示词缓存，api.prompt_cache 不会生效\n", cfg.API.Type)
+	}
+	if setter, ok := apiClient.(api.ContextWindowSetter); ok {
+		setter.SetContextWindow(cfg.API.ContextWindow)
+	}
+
+	// 设置重试策略和单次请求超时
+	apiClient.SetRetryPolicy(cfg.API.Retry)
+	apiClient.SetRequestTimeout(time.Duration(cfg.API.Timeout) * time.Second)
+
+	// 所有并发任务共享一个限流器，遇到429时自动降低并发
+	apiClient.SetRateLimiter(api.NewRateLimiter(cfg.API.RPM, cfg.API.TPM, cfg.Check.Concurrency))
+
+	// 提示分片大小的计算方式
+	printChunkSizing(cfg)
+
 	// 处理时间过滤参数
 	var svnFilterAfter *time.Time
 	if cfg.SVN.FilterAfter != "" {
@@ -71,10 +102,109 @@ func main() {
 		fmt.Printf("创建代码检查器失败: %v\n", err)
 		os.Exit(1)
 	}
+	checker.SetContinueOnError(cfg.Check.ContinueOnError)
+	checker.SetRetryFailed(*retryFailed)
+	checker.SetShutdownGrace(time.Duration(cfg.Check.ShutdownGrace) * time.Second)
+	checker.SetOutputLayout(cfg.Check.OutputLayout)
+	checker.SetFormats(cfg.Check.Formats)
+	checker.SetLineNumbers(cfg.Check.LineNumbers)
+	checker.SetMaxChunkTokens(cfg.API.MaxChunkTokens)
+	checker.SetContextWindow(cfg.API.ContextWindow)
+	checker.SetMaxContinuations(cfg.API.MaxContinuations)
+	checker.SetRetryPolicy(cfg.API.Retry)
+	checker.SetBudget(cfg.Budget)
+	if _, ok := api.LookupModel(cfg.API.Model); cfg.Budget.MaxCost > 0 && !ok {
+		fmt.Printf("警告: 内置模型目录中没有 %s，无法估算费用，budget.max_cost 不会生效\n", cfg.API.Model)
+	}
+	checker.SetChunkOptions(cfg.Check.ChunkStrategy, cfg.Check.ChunkOverlap, cfg.Check.ChunkContext)
+
+	// 试运行只输出检查计划
+	if *dryRun {
+		if _, err := checker.PlanDirectory(cfg.Check.Directory, cfg.Check.OutputDir); err != nil {
+			fmt.Printf("生成检查计划失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 第一次收到Ctrl-C或终止信号时停止派发新任务并等待进行中的任务完成，再次收到时强制退出
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Printf("\n收到中断信号，正在安全退出，再次中断将强制退出\n")
+		cancel()
+		<-sigChan
+		fmt.Printf("\n再次收到中断信号，强制退出，进行中的任务将在下次运行时重新检查\n")
+		os.Exit(130)
+	}()
+
+	// 设置整次检查的运行时限
+	if cfg.Check.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Check.RunTimeout)*time.Minute)
+		defer cancel()
+	}
 
 	// 执行目录检查
-	if err := checker.CheckDirectory(cfg.Check.Directory, cfg.Check.OutputDir); err != nil {
+	if err := checker.CheckDirectory(ctx, cfg.Check.Directory, cfg.Check.OutputDir); err != nil {
 		fmt.Printf("执行检查失败: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// printChunkSizing 输出分片大小的计算方式，模型不在内置目录中时提示手动配置
+func printChunkSizing(cfg *config.Config) {
+	switch {
+	case cfg.API.MaxChunkTokens > 0:
+		fmt.Printf("分片大小：每片最多 %d tokens（api.max_chunk_tokens）\n", cfg.API.MaxChunkTokens)
+	case cfg.API.MaxTextLength > 0:
+		fmt.Printf("分片大小：每片最多 %d 字节（api.max_text_length）\n", cfg.API.MaxTextLength)
+	case cfg.API.ContextWindow > 0:
+		fmt.Printf("分片大小：根据上下文窗口（%d tokens，api.context_window）和 max_tokens（%d）自动计算\n", cfg.API.ContextWindow, cfg.API.MaxTokens)
+	default:
+		info, ok := api.LookupModel(cfg.API.Model)
+		if !ok {
+			fmt.Printf("警告: 内置模型目录中没有 %s，按每片 %d 字节分片，可通过 api.max_chunk_tokens 或 api.context_window 指定\n", cfg.API.Model, checker.DefaultMaxTextLength)
+			return
+		}
+		fmt.Printf("分片大小：根据模型 %s 的上下文窗口（%d tokens）和 max_tokens（%d）自动计算\n", info.Name, info.ContextWindow, cfg.API.MaxTokens)
+		if info.MaxOutput > 0 && cfg.API.MaxTokens > info.MaxOutput {
+			fmt.Printf("警告: max_tokens（%d）超过模型 %s 的输出上限（%d）\n", cfg.API.MaxTokens, info.Name, info.MaxOutput)
+		}
+	}
+}
+
+// usage 输出命令行用法
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "用法:\n")
+	fmt.Fprintf(out, "  %s [参数]            执行代码检查\n", os.Args[0])
+	fmt.Fprintf(out, "  %s providers         列出支持的AI服务提供商\n\n", os.Args[0])
+	fmt.Fprintf(out, "参数:\n")
+	flag.PrintDefaults()
+}
+
+// printProviders 输出所有已注册的AI服务提供商及其默认配置
+func printProviders() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "类型\t默认模型\t默认max_tokens\t需要密钥\t默认地址\t说明")
+	for _, p := range api.Providers() {
+		key := "否"
+		if p.KeyRequired {
+			key = "是"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", p.Name, orDash(p.DefaultModel), p.DefaultMaxTokens, key, orDash(p.DefaultURL), p.Description)
+	}
+	w.Flush()
+}
+
+// orDash 空字符串显示为 "-"
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
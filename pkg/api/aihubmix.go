@@ -4,6 +4,18 @@ import (
 	"fmt"
 )
 
+func init() {
+	Register(Provider{
+		Name:             "aihubmix",
+		Description:      "AiHubMix平台",
+		New:              NewAiHubMixClient,
+		DefaultURL:       "https://aihubmix.com/v1/chat/completions",
+		DefaultModel:     "gpt-3.5-turbo",
+		DefaultMaxTokens: 60000,
+		KeyRequired:      true,
+	})
+}
+
 // AiHubMixClient 实现AiHubMix API客户端
 type AiHubMixClient struct {
 	BaseAIClient
@@ -36,39 +48,15 @@ func (c *AiHubMixClient) BuildPrompt(codeContent string, rules []Rule, model str
 		"max_tokens":  maxTokens,
 	}
 
+	// 结构化输出时使用json_schema约束返回格式
+	if format := c.JSONSchemaResponseFormat(); format != nil {
+		payload["response_format"] = format
+	}
+
 	return payload, nil
 }
 
 // ParseResponse 解析AiHubMix API响应
 func (c *AiHubMixClient) ParseResponse(responseData map[string]interface{}) (string, error) {
-	// 检查是否有choices字段
-	choices, ok := responseData["choices"]
-	if !ok {
-		return "", fmt.Errorf("no choices in response")
-	}
-
-	choicesArray, ok := choices.([]interface{})
-	if !ok || len(choicesArray) == 0 {
-		return "", fmt.Errorf("invalid choices format")
-	}
-
-	// 获取第一个choice
-	firstChoice, ok := choicesArray[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid choice format")
-	}
-
-	// 获取message
-	message, ok := firstChoice["message"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("no message in choice")
-	}
-
-	// 获取content
-	content, ok := message["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("no content in message")
-	}
-
-	return content, nil
+	return parseChatCompletion(responseData)
 }
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anthropicVersion Anthropic Messages API的版本
+const anthropicVersion = "2023-06-01"
+
+func init() {
+	Register(Provider{
+		Name:             "anthropic",
+		Description:      "Anthropic Messages API（Claude）",
+		New:              NewAnthropicClient,
+		DefaultURL:       "https://api.anthropic.com/v1/messages",
+		DefaultModel:     "claude-sonnet-4-20250514",
+		DefaultMaxTokens: 8192,
+		KeyRequired:      true,
+	})
+}
+
+// AnthropicClient 实现Anthropic Messages API客户端
+type AnthropicClient struct {
+	BaseAIClient
+	promptCache bool
+}
+
+// NewAnthropicClient 创建新的Anthropic客户端
+func NewAnthropicClient() AIClient {
+	return &AnthropicClient{
+		BaseAIClient: BaseAIClient{
+			auth:    HeaderAuth{Header: "x-api-key"},
+			headers: map[string]string{"anthropic-version": anthropicVersion},
+		},
+	}
+}
+
+// SetPromptCache 设置是否在system末尾添加缓存标记，实现PromptCacher
+func (c *AnthropicClient) SetPromptCache(enable bool) {
+	c.promptCache = enable
+}
+
+// BuildPrompt 构建Anthropic API的请求数据
+// 审查说明和规则放在顶层system中，代码作为user消息；开启提示词缓存时在system末尾添加缓存标记，
+// 同一规则的后续请求可以复用这部分前缀
+func (c *AnthropicClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
+	system := map[string]interface{}{
+		"type": "text",
+		"text": systemPrompt + "\n\n" + c.GetPromptInstructions(rules),
+	}
+	if c.promptCache {
+		system["cache_control"] = map[string]string{"type": "ephemeral"}
+	}
+
+	return map[string]interface{}{
+		"model":      model,
+		"max_tokens": maxTokens,
+		"system":     []map[string]interface{}{system},
+		"messages": []map[string]interface{}{
+			{
+				"role": "user",
+				"content": []map[string]interface{}{
+					{"type": "text", "text": c.GetCodePrompt(codeContent)},
+				},
+			},
+		},
+		"temperature": 0.2,
+	}, nil
+}
+
+// ParseResponse 解析Anthropic API的响应数据，拼接content中所有text块的内容
+func (c *AnthropicClient) ParseResponse(responseData map[string]interface{}) (string, error) {
+	if err := providerError(responseData); err != nil {
+		return "", err
+	}
+
+	blocks, ok := responseData["content"].([]interface{})
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "no content in response"}
+	}
+	if reason, _ := responseData["stop_reason"].(string); reason == "refusal" {
+		return "", &ResponseError{Kind: ResponseRefusal, Message: anthropicText(blocks)}
+	}
+	if len(blocks) == 0 {
+		return "", &ResponseError{Kind: ResponseEmptyChoices}
+	}
+	return anthropicText(blocks), nil
+}
+
+// anthropicText 拼接content中text块的文本，忽略thinking等其他类型的块
+func anthropicText(blocks []interface{}) string {
+	var b strings.Builder
+	for _, block := range blocks {
+		m, ok := block.(map[string]interface{})
+		if !ok || m["type"] != "text" {
+			continue
+		}
+		text, _ := m["text"].(string)
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// ParseFinishReason 读取stop_reason，并换算为OpenAI风格的结束原因：max_tokens对应length，end_turn和stop_sequence对应stop
+func (c *AnthropicClient) ParseFinishReason(responseData map[string]interface{}) string {
+	reason, _ := responseData["stop_reason"].(string)
+	switch reason {
+	case "max_tokens":
+		return FinishReasonLength
+	case "end_turn", "stop_sequence":
+		return "stop"
+	}
+	return reason
+}
+
+// BuildContinuation 构建续写请求：把已输出的内容作为最后一条assistant消息，模型会直接接着输出
+func (c *AnthropicClient) BuildContinuation(payload map[string]interface{}, partial string) (map[string]interface{}, error) {
+	messages, ok := payload["messages"].([]map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload has no messages to continue")
+	}
+
+	next := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		next[k] = v
+	}
+	continued := make([]map[string]interface{}, 0, len(messages)+1)
+	continued = append(continued, messages...)
+	// 最后一条assistant消息不能以空白结尾
+	continued = append(continued, map[string]interface{}{"role": "assistant", "content": strings.TrimRight(partial, " \t\r\n")})
+	next["messages"] = continued
+	return next, nil
+}
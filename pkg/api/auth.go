@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Authenticator 为API请求添加鉴权信息，body为请求体，供需要对请求签名的鉴权方式使用
+type Authenticator interface {
+	Authenticate(req *http.Request, body []byte, apiKey string) error
+}
+
+// BearerAuth 使用 "Authorization: Bearer <key>" 鉴权，OpenAI兼容服务的默认方式
+// 密钥为空时不添加请求头，便于访问不需要密钥的本地服务
+type BearerAuth struct{}
+
+// Authenticate 添加Authorization请求头
+func (BearerAuth) Authenticate(req *http.Request, body []byte, apiKey string) error {
+	if apiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	}
+	return nil
+}
+
+// HeaderAuth 把密钥放在指定的请求头中，如Anthropic的x-api-key
+type HeaderAuth struct {
+	Header string // 请求头名称
+}
+
+// Authenticate 添加密钥请求头
+func (a HeaderAuth) Authenticate(req *http.Request, body []byte, apiKey string) error {
+	if apiKey != "" {
+		req.Header.Set(a.Header, apiKey)
+	}
+	return nil
+}
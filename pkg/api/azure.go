@@ -0,0 +1,31 @@
+package api
+
+// AzureDefaultAPIVersion 未配置api.azure.api_version时使用的Azure OpenAI API版本
+const AzureDefaultAPIVersion = "2024-10-21"
+
+func init() {
+	Register(Provider{
+		Name:             "azure",
+		Description:      "Azure OpenAI，url根据api.azure中的resource、deployment和api_version生成",
+		New:              NewAzureClient,
+		DefaultURL:       "https://{resource}.openai.azure.com/openai/deployments/{deployment}/chat/completions?api-version={api_version}",
+		DefaultMaxTokens: 4096,
+		KeyRequired:      true,
+	})
+}
+
+// AzureClient 实现Azure OpenAI客户端，请求和响应格式与OpenAI相同，使用api-key请求头鉴权
+type AzureClient struct {
+	OpenAIClient
+}
+
+// NewAzureClient 创建新的Azure OpenAI客户端
+func NewAzureClient() AIClient {
+	return &AzureClient{
+		OpenAIClient: OpenAIClient{
+			BaseAIClient: BaseAIClient{
+				auth: HeaderAuth{Header: "api-key"},
+			},
+		},
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// CallInfo 记录一次CallAPI调用的过程信息，Attempts和Latency由CallAPI填写
+type CallInfo struct {
+	MaxAttempts int           // 调用方限制的最多请求次数，小于重试策略时生效，0表示按重试策略
+	Attempts    int           // 实际发送的请求次数，大于1表示发生了重试
+	Latency     time.Duration // 从第一次请求到返回的总耗时，包括重试等待
+}
+
+// callInfoKey context中保存CallInfo的键
+type callInfoKey struct{}
+
+// WithCallInfo 返回携带CallInfo的context，使用该context调用CallAPI后可以从返回的CallInfo中读取调用信息
+func WithCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	info := &CallInfo{}
+	return context.WithValue(ctx, callInfoKey{}, info), info
+}
+
+// callInfoFrom 读取context中的CallInfo，没有时返回nil
+func callInfoFrom(ctx context.Context) *CallInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info
+}
+
+// ParseFinishReason 读取OpenAI风格响应中第一个choice的finish_reason，没有时返回空字符串
+func (c *BaseAIClient) ParseFinishReason(responseData map[string]interface{}) string {
+	choices, ok := responseData["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return ""
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	reason, _ := choice["finish_reason"].(string)
+	return reason
+}
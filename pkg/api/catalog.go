@@ -0,0 +1,126 @@
+package api
+
+import (
+	"sort"
+	"strings"
+)
+
+// ModelInfo 定义模型的上下文窗口、输出上限和价格
+// 价格为每百万token的价格，仅用于估算，以服务商的实际账单为准
+type ModelInfo struct {
+	Name          string  `json:"name"`           // 模型名称，匹配时作为前缀
+	Tokenizer     string  `json:"tokenizer"`      // 分词器家族，见tokenizerFamilies
+	ContextWindow int     `json:"context_window"` // 上下文窗口（输入+输出）的token数
+	MaxOutput     int     `json:"max_output"`     // 单次请求最多输出的token数
+	InputPrice    float64 `json:"input_price"`    // 每百万输入token的价格
+	OutputPrice   float64 `json:"output_price"`   // 每百万输出token的价格
+	Currency      string  `json:"currency"`       // 价格的币种：USD 或 CNY
+}
+
+// modelCatalog 内置的模型目录
+var modelCatalog = []ModelInfo{
+	// OpenAI
+	{Name: "gpt-4o", Tokenizer: "o200k", ContextWindow: 128000, MaxOutput: 16384, InputPrice: 2.5, OutputPrice: 10, Currency: "USD"},
+	{Name: "gpt-4o-mini", Tokenizer: "o200k", ContextWindow: 128000, MaxOutput: 16384, InputPrice: 0.15, OutputPrice: 0.6, Currency: "USD"},
+	{Name: "gpt-4.1", Tokenizer: "o200k", ContextWindow: 1047576, MaxOutput: 32768, InputPrice: 2, OutputPrice: 8, Currency: "USD"},
+	{Name: "gpt-4.1-mini", Tokenizer: "o200k", ContextWindow: 1047576, MaxOutput: 32768, InputPrice: 0.4, OutputPrice: 1.6, Currency: "USD"},
+	{Name: "gpt-4.1-nano", Tokenizer: "o200k", ContextWindow: 1047576, MaxOutput: 32768, InputPrice: 0.1, OutputPrice: 0.4, Currency: "USD"},
+	{Name: "gpt-4-turbo", Tokenizer: "cl100k", ContextWindow: 128000, MaxOutput: 4096, InputPrice: 10, OutputPrice: 30, Currency: "USD"},
+	{Name: "gpt-3.5-turbo", Tokenizer: "cl100k", ContextWindow: 16385, MaxOutput: 4096, InputPrice: 0.5, OutputPrice: 1.5, Currency: "USD"},
+	{Name: "o3-mini", Tokenizer: "o200k", ContextWindow: 200000, MaxOutput: 100000, InputPrice: 1.1, OutputPrice: 4.4, Currency: "USD"},
+	{Name: "o4-mini", Tokenizer: "o200k", ContextWindow: 200000, MaxOutput: 100000, InputPrice: 1.1, OutputPrice: 4.4, Currency: "USD"},
+
+	// Anthropic
+	{Name: "claude-3-5-haiku", Tokenizer: "claude", ContextWindow: 200000, MaxOutput: 8192, InputPrice: 0.8, OutputPrice: 4, Currency: "USD"},
+	{Name: "claude-3-5-sonnet", Tokenizer: "claude", ContextWindow: 200000, MaxOutput: 8192, InputPrice: 3, OutputPrice: 15, Currency: "USD"},
+	{Name: "claude-3-7-sonnet", Tokenizer: "claude", ContextWindow: 200000, MaxOutput: 64000, InputPrice: 3, OutputPrice: 15, Currency: "USD"},
+	{Name: "claude-sonnet-4", Tokenizer: "claude", ContextWindow: 200000, MaxOutput: 64000, InputPrice: 3, OutputPrice: 15, Currency: "USD"},
+	{Name: "claude-opus-4", Tokenizer: "claude", ContextWindow: 200000, MaxOutput: 32000, InputPrice: 15, OutputPrice: 75, Currency: "USD"},
+
+	// Google
+	{Name: "gemini-1.5-flash", Tokenizer: "gemini", ContextWindow: 1048576, MaxOutput: 8192, InputPrice: 0.075, OutputPrice: 0.3, Currency: "USD"},
+	{Name: "gemini-1.5-pro", Tokenizer: "gemini", ContextWindow: 2097152, MaxOutput: 8192, InputPrice: 1.25, OutputPrice: 5, Currency: "USD"},
+	{Name: "gemini-2.0-flash", Tokenizer: "gemini", ContextWindow: 1048576, MaxOutput: 8192, InputPrice: 0.1, OutputPrice: 0.4, Currency: "USD"},
+	{Name: "gemini-2.5-flash", Tokenizer: "gemini", ContextWindow: 1048576, MaxOutput: 65536, InputPrice: 0.3, OutputPrice: 2.5, Currency: "USD"},
+	{Name: "gemini-2.5-pro", Tokenizer: "gemini", ContextWindow: 1048576, MaxOutput: 65536, InputPrice: 1.25, OutputPrice: 10, Currency: "USD"},
+
+	// DeepSeek
+	{Name: "deepseek-chat", Tokenizer: "deepseek", ContextWindow: 65536, MaxOutput: 8192, InputPrice: 2, OutputPrice: 8, Currency: "CNY"},
+	{Name: "deepseek-v3", Tokenizer: "deepseek", ContextWindow: 65536, MaxOutput: 8192, InputPrice: 2, OutputPrice: 8, Currency: "CNY"},
+	{Name: "deepseek-reasoner", Tokenizer: "deepseek", ContextWindow: 65536, MaxOutput: 8192, InputPrice: 4, OutputPrice: 16, Currency: "CNY"},
+	{Name: "deepseek-r1", Tokenizer: "deepseek", ContextWindow: 65536, MaxOutput: 8192, InputPrice: 4, OutputPrice: 16, Currency: "CNY"},
+
+	// 通义千问
+	{Name: "qwen-turbo", Tokenizer: "qwen", ContextWindow: 1000000, MaxOutput: 8192, InputPrice: 0.3, OutputPrice: 0.6, Currency: "CNY"},
+	{Name: "qwen-plus", Tokenizer: "qwen", ContextWindow: 131072, MaxOutput: 8192, InputPrice: 0.8, OutputPrice: 2, Currency: "CNY"},
+	{Name: "qwen-max", Tokenizer: "qwen", ContextWindow: 32768, MaxOutput: 8192, InputPrice: 2.4, OutputPrice: 9.6, Currency: "CNY"},
+	{Name: "qwen2.5-7b-instruct", Tokenizer: "qwen", ContextWindow: 32768, MaxOutput: 8192, InputPrice: 0, OutputPrice: 0, Currency: "CNY"},
+	{Name: "qwen2.5-32b-instruct", Tokenizer: "qwen", ContextWindow: 32768, MaxOutput: 8192, InputPrice: 1.26, OutputPrice: 1.26, Currency: "CNY"},
+	{Name: "qwen2.5-72b-instruct", Tokenizer: "qwen", ContextWindow: 32768, MaxOutput: 8192, InputPrice: 4.13, OutputPrice: 4.13, Currency: "CNY"},
+	{Name: "qwen2.5-coder-32b-instruct", Tokenizer: "qwen", ContextWindow: 32768, MaxOutput: 8192, InputPrice: 1.26, OutputPrice: 1.26, Currency: "CNY"},
+	{Name: "qwen3-coder", Tokenizer: "qwen", ContextWindow: 262144, MaxOutput: 65536, InputPrice: 4, OutputPrice: 16, Currency: "CNY"},
+
+	// 豆包
+	{Name: "doubao-1.5-pro-32k", Tokenizer: "doubao", ContextWindow: 32768, MaxOutput: 12288, InputPrice: 0.8, OutputPrice: 2, Currency: "CNY"},
+	{Name: "doubao-1.5-pro-256k", Tokenizer: "doubao", ContextWindow: 262144, MaxOutput: 12288, InputPrice: 5, OutputPrice: 9, Currency: "CNY"},
+	{Name: "doubao-seed-1.6", Tokenizer: "doubao", ContextWindow: 262144, MaxOutput: 32768, InputPrice: 0.8, OutputPrice: 8, Currency: "CNY"},
+
+	// Llama（本地部署一般不计费）
+	{Name: "llama3", Tokenizer: "llama", ContextWindow: 8192, MaxOutput: 4096, Currency: "USD"},
+	{Name: "llama3.1", Tokenizer: "llama", ContextWindow: 131072, MaxOutput: 4096, Currency: "USD"},
+	{Name: "llama3.2", Tokenizer: "llama", ContextWindow: 131072, MaxOutput: 4096, Currency: "USD"},
+	{Name: "llama3.3", Tokenizer: "llama", ContextWindow: 131072, MaxOutput: 4096, Currency: "USD"},
+}
+
+// Models 返回内置模型目录，按名称排序
+func Models() []ModelInfo {
+	models := make([]ModelInfo, len(modelCatalog))
+	copy(models, modelCatalog)
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+	return models
+}
+
+// LookupModel 按模型名称查找模型信息
+// 名称不区分大小写，忽略 "Qwen/"、"deepseek-ai/" 这样的服务商前缀，
+// 并匹配最长的名称前缀，因此 "gpt-4o-mini-2024-07-18" 会匹配到 gpt-4o-mini；
+// 前缀之后必须是名称结尾或 "-"、":" 等分隔符，避免 "llama3.2" 匹配到 llama3 这样的其他版本
+func LookupModel(model string) (ModelInfo, bool) {
+	name := normalizeModelName(model)
+	var best ModelInfo
+	found := false
+	for _, info := range modelCatalog {
+		if matchModelPrefix(name, info.Name) && len(info.Name) > len(best.Name) {
+			best = info
+			found = true
+		}
+	}
+	return best, found
+}
+
+// matchModelPrefix 判断name是否以prefix开头，且prefix之后不是字母、数字或 "."
+func matchModelPrefix(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	c := name[len(prefix)]
+	return !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '.')
+}
+
+// normalizeModelName 规范化模型名称
+func normalizeModelName(model string) string {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// Cost 根据输入和输出token数估算费用
+func (m ModelInfo) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*m.InputPrice + float64(outputTokens)*m.OutputPrice) / 1e6
+}
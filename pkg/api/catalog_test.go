@@ -0,0 +1,33 @@
+package api
+
+import "testing"
+
+func TestLookupModel(t *testing.T) {
+	for _, tc := range []struct {
+		model string
+		want  string // 匹配到的目录条目，空字符串表示不在目录中
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"gpt-4o-mini-2024-07-18", "gpt-4o-mini"},
+		{"Pro/deepseek-ai/DeepSeek-R1", "deepseek-r1"},
+		{"llama3:8b", "llama3"},
+		{"llama3.1:8b", "llama3.1"},
+		{"llama3.2", "llama3.2"},
+		{"llama3.3:70b", "llama3.3"},
+		{"llama3.4", ""},
+		{"llama30", ""},
+		{"qwen2.5-coder-32b-instruct", "qwen2.5-coder-32b-instruct"},
+		{"unknown-model", ""},
+	} {
+		info, ok := LookupModel(tc.model)
+		if tc.want == "" {
+			if ok {
+				t.Errorf("LookupModel(%q) = %s, want not found", tc.model, info.Name)
+			}
+			continue
+		}
+		if !ok || info.Name != tc.want {
+			t.Errorf("LookupModel(%q) = %s (found %v), want %s", tc.model, info.Name, ok, tc.want)
+		}
+	}
+}
@@ -2,12 +2,15 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,13 +27,46 @@ type Rule struct {
 type AIClient interface {
 	BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error)
 	ParseResponse(responseData map[string]interface{}) (string, error)
-	CallAPI(payload map[string]interface{}, apiURL, apiKey string) (map[string]interface{}, error)
+	ParseUsage(responseData map[string]interface{}) Usage
+	ParseFinishReason(responseData map[string]interface{}) string
+	BuildContinuation(payload map[string]interface{}, partial string) (map[string]interface{}, error)
+	CallAPI(ctx context.Context, payload map[string]interface{}, apiURL, apiKey string) (map[string]interface{}, error)
 	SetLogFile(enable bool)
+	SetRetryPolicy(policy RetryPolicy)
+	SetRequestTimeout(timeout time.Duration)
+	SetStructuredOutput(enable bool)
+	StructuredOutput() bool
+	SetLineNumbers(enable bool)
+	SetRateLimiter(limiter *RateLimiter)
+	SetAuthenticator(auth Authenticator)
 }
 
+// PromptCacher 由支持显式提示词缓存的客户端实现，调用方通过类型断言判断是否支持
+type PromptCacher interface {
+	// SetPromptCache 设置是否为提示词中各请求共享的前缀添加缓存标记
+	SetPromptCache(enable bool)
+}
+
+// ContextWindowSetter 由需要在请求中指定上下文长度的客户端（如本地服务）实现，调用方通过类型断言判断是否支持
+type ContextWindowSetter interface {
+	// SetContextWindow 设置模型的上下文窗口大小（tokens）
+	SetContextWindow(tokens int)
+}
+
+// httpClient 所有AI客户端共享的HTTP客户端，超时由每次请求的context控制
+var httpClient = &http.Client{}
+
 // BaseAIClient 提供基础实现
 type BaseAIClient struct {
-	enableLog bool
+	enableLog      bool
+	retryPolicy    RetryPolicy
+	requestTimeout time.Duration
+	structured     bool
+	lineNumbers    bool
+	limiter        *RateLimiter
+	auth           Authenticator     // 请求鉴权方式，为nil时使用BearerAuth
+	headers        map[string]string // 每个请求都要附带的请求头，如API版本
+	stream         streamDecoder     // 请求流式响应的客户端用于聚合响应，为nil表示非流式
 }
 
 // SetLogFile 设置日志开关
@@ -38,6 +74,56 @@ func (c *BaseAIClient) SetLogFile(enable bool) {
 	c.enableLog = enable
 }
 
+// SetRetryPolicy 设置API调用的重试策略
+func (c *BaseAIClient) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetRequestTimeout 设置单次HTTP请求的超时时间，0表示不限制
+func (c *BaseAIClient) SetRequestTimeout(timeout time.Duration) {
+	c.requestTimeout = timeout
+}
+
+// SetStructuredOutput 设置是否要求模型以JSON格式返回结构化的问题列表
+func (c *BaseAIClient) SetStructuredOutput(enable bool) {
+	c.structured = enable
+}
+
+// StructuredOutput 返回是否启用了结构化输出
+func (c *BaseAIClient) StructuredOutput() bool {
+	return c.structured
+}
+
+// SetLineNumbers 设置待审查的代码是否带有行号前缀，开启后提示词会要求模型引用这些行号
+func (c *BaseAIClient) SetLineNumbers(enable bool) {
+	c.lineNumbers = enable
+}
+
+// SetRateLimiter 设置所有客户端共享的限流器，nil表示不限流
+func (c *BaseAIClient) SetRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
+
+// SetAuthenticator 设置请求的鉴权方式，替换服务商默认的鉴权方式
+func (c *BaseAIClient) SetAuthenticator(auth Authenticator) {
+	c.auth = auth
+}
+
+// JSONSchemaResponseFormat 返回OpenAI风格的json_schema响应格式，未启用结构化输出时返回nil
+func (c *BaseAIClient) JSONSchemaResponseFormat() map[string]interface{} {
+	if !c.structured {
+		return nil
+	}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "code_check_findings",
+			"strict": true,
+			"schema": FindingsSchema(),
+		},
+	}
+}
+
 // logAPIRequest 记录API请求日志
 func (c *BaseAIClient) logAPIRequest(payload map[string]interface{}, apiURL string) error {
 	if !c.enableLog {
@@ -79,8 +165,40 @@ func (c *BaseAIClient) logAPIRequest(payload map[string]interface{}, apiURL stri
 	return nil
 }
 
+// markdownOutputPrompt 要求模型以Markdown格式返回结果的提示词
+const markdownOutputPrompt = `请使用以下Markdown格式返回分析结果：
+1. 对于发现的每个问题：
+   - 使用二级标题(##)准确描述问题
+   - 使用列表(-)详细说明问题的具体表现、可能造成的影响
+   - 使用引用(>)给出专业的改进建议
+   - 如果需要，使用代码块()展示正确的实现方式
+
+如果确实没有发现任何问题，请返回："经过仔细审查，未发现任何问题。"
+`
+
+// structuredOutputPrompt 要求模型以JSON格式返回结果的提示词
+const structuredOutputPrompt = `请严格按照以下JSON格式返回分析结果，不要输出JSON以外的任何内容：
+{"findings": [{"title": "准确描述问题的标题", "severity": "high|medium|low|info", "start_line": 起始行号, "end_line": 结束行号, "description": "问题的具体表现和可能造成的影响", "suggestion": "专业的改进建议", "fixed_code": "正确的实现方式，不需要时为空字符串"}]}
+
+行号无法确定时填0。如果确实没有发现任何问题，请返回：{"findings": []}
+`
+
+// lineNumbersPrompt 代码带有行号前缀时追加的提示词
+const lineNumbersPrompt = `
+待审查的代码每行开头带有该行在文件中的行号，格式为 "行号| 代码"，行号不属于代码本身。描述问题时请使用这些行号，并在每个问题的标题中注明所在行号，如“（第12-15行）”。
+`
+
+// systemPrompt 系统提示词
+const systemPrompt = "你是一个专业的代码审计专家，擅长发现代码中的潜在问题和安全隐患。"
+
 // GetPromptContent 返回通用的提示词内容
 func (c *BaseAIClient) GetPromptContent(codeContent string, rules []Rule) string {
+	return c.GetPromptInstructions(rules) + c.GetCodePrompt(codeContent)
+}
+
+// GetPromptInstructions 返回提示词中代码之前的部分（审查说明、输出格式和规则），
+// 同一规则的所有请求这部分相同，可以作为缓存的前缀
+func (c *BaseAIClient) GetPromptInstructions(rules []Rule) string {
 	content := `我是一位资深的代码审计专家，现在需要你配合我对以下代码进行严格的安全性和质量审查。请你也以代码审计专家的身份，仔细分析代码中的每一个细节，不放过任何潜在的问题。
 
 作为代码审计专家，我们需要：
@@ -90,27 +208,29 @@ func (c *BaseAIClient) GetPromptContent(codeContent string, rules []Rule) string
 4. 关注代码的健壮性和可维护性
 5. 提供专业、具体且可执行的改进建议
 
-请使用以下Markdown格式返回分析结果：
-1. 对于发现的每个问题：
-   - 使用二级标题(##)准确描述问题
-   - 使用列表(-)详细说明问题的具体表现、可能造成的影响
-   - 使用引用(>)给出专业的改进建议
-   - 如果需要，使用代码块()展示正确的实现方式
-
-如果确实没有发现任何问题，请返回："经过仔细审查，未发现任何问题。"
-
-需要重点关注的规则：
 `
+	if c.structured {
+		content += structuredOutputPrompt
+	} else {
+		content += markdownOutputPrompt
+	}
+	if c.lineNumbers {
+		content += lineNumbersPrompt
+	}
+	content += "\n需要重点关注的规则：\n"
 	for _, rule := range rules {
 		content += fmt.Sprintf("- %s: %s\n", rule.Name, rule.Description)
 	}
-
-	content += fmt.Sprintf("\n待审查的代码：\n```\n%s\n```", codeContent)
 	return content
 }
 
-// CallAPI 提供基础的API调用实现
-func (c *BaseAIClient) CallAPI(payload map[string]interface{}, apiURL, apiKey string) (map[string]interface{}, error) {
+// GetCodePrompt 返回提示词中待审查代码的部分
+func (c *BaseAIClient) GetCodePrompt(codeContent string) string {
+	return fmt.Sprintf("\n待审查的代码：\n```\n%s\n```", codeContent)
+}
+
+// CallAPI 提供基础的API调用实现，对临时错误按重试策略进行重试
+func (c *BaseAIClient) CallAPI(ctx context.Context, payload map[string]interface{}, apiURL, apiKey string) (map[string]interface{}, error) {
 	// 记录API请求日志
 	if err := c.logAPIRequest(payload, apiURL); err != nil {
 		fmt.Printf("Warning: Failed to log API request: %v\n", err)
@@ -121,29 +241,158 @@ func (c *BaseAIClient) CallAPI(payload map[string]interface{}, apiURL, apiKey st
 		return nil, fmt.Errorf("marshal payload failed: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	// 调用方通过WithCallInfo传入CallInfo时，记录请求次数和总耗时
+	if info := callInfoFrom(ctx); info != nil {
+		start := time.Now()
+		defer func() {
+			info.Latency = time.Since(start)
+		}()
+	}
+
+	policy := c.retryPolicy.normalize()
+	if info := callInfoFrom(ctx); info != nil && info.MaxAttempts > 0 && info.MaxAttempts < policy.MaxAttempts {
+		policy.MaxAttempts = info.MaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		if info := callInfoFrom(ctx); info != nil {
+			info.Attempts = attempt
+		}
+		result, err := c.limitedRequest(ctx, jsonData, payload, apiURL, apiKey)
+		if err == nil {
+			return result, nil
+		}
+
+		// 调用方取消或整体超时时不再重试
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("API request canceled: %w", ctx.Err())
+		}
+		if !IsRetryable(err) {
+			return nil, err
+		}
+		if attempt >= policy.MaxAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		var serverHint time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			serverHint = apiErr.RetryAfter
+		}
+		delay := policy.backoff(attempt, serverHint)
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+			c.limiter.OnRateLimited(delay)
+		}
+		fmt.Printf("Warning: API request failed (attempt %d/%d), retrying in %v: %v\n",
+			attempt, policy.MaxAttempts, delay.Round(time.Millisecond), err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("API request canceled: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// limitedRequest 在限流器允许后发送一次API请求，成功后用实际用量修正估算的token数
+func (c *BaseAIClient) limitedRequest(ctx context.Context, jsonData []byte, payload map[string]interface{}, apiURL, apiKey string) (map[string]interface{}, error) {
+	if c.limiter == nil {
+		return c.doRequest(ctx, jsonData, apiURL, apiKey)
+	}
+
+	model, _ := payload["model"].(string)
+	estimated := EstimateTokens(model, string(jsonData))
+	release, err := c.limiter.Acquire(ctx, estimated)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	result, err := c.doRequest(ctx, jsonData, apiURL, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	c.limiter.OnSuccess()
+	if usage := c.ParseUsage(result); !usage.IsZero() {
+		c.limiter.Adjust(usage.TotalTokens - estimated)
+	}
+	return result, nil
+}
+
+// doRequest 发送一次API请求
+// 流式响应时requestTimeout是空闲超时：超过该时间没有收到任何数据才中断，生成时间长不会超时
+func (c *BaseAIClient) doRequest(ctx context.Context, jsonData []byte, apiURL, apiKey string) (map[string]interface{}, error) {
+	touch := func() {}
+	var idle atomic.Bool
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		if c.stream == nil {
+			ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+			timer := time.AfterFunc(c.requestTimeout, func() {
+				idle.Store(true)
+				cancel()
+			})
+			defer timer.Stop()
+			touch = func() { timer.Reset(c.requestTimeout) }
+		}
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request failed: %v", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
 	req.Header.Set("Content-Type", "application/json")
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	auth := c.auth
+	if auth == nil {
+		auth = BearerAuth{}
+	}
+	if err := auth.Authenticate(req, jsonData, apiKey); err != nil {
+		return nil, fmt.Errorf("authenticate request failed: %w", err)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %v", err)
+		if idle.Load() {
+			return nil, fmt.Errorf("API request failed: no data received for %v: %w", c.requestTimeout, context.DeadlineExceeded)
+		}
+		return nil, fmt.Errorf("API request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			Message:    bodyErrorMessage(body),
+			RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+		}
 	}
 
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode response failed: %v", err)
+	if c.stream != nil {
+		result, err = c.stream(resp.Body, touch)
+		if err != nil {
+			if idle.Load() {
+				return nil, fmt.Errorf("no data received for %v: %w", c.requestTimeout, context.DeadlineExceeded)
+			}
+			return nil, err
+		}
+	} else if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response failed: %w", err)
+	}
+
+	// 部分服务在HTTP 200的响应中返回error对象，按可重试的错误处理
+	if err := providerError(result); err != nil {
+		return nil, err
 	}
 
 	return result, nil
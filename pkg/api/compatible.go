@@ -0,0 +1,54 @@
+package api
+
+func init() {
+	Register(Provider{
+		Name:             "openai-compatible",
+		Description:      "任意兼容OpenAI chat completions接口的服务，需要配置url和model",
+		New:              NewCompatibleClient,
+		DefaultMaxTokens: 4096,
+	})
+}
+
+// CompatibleClient 实现通用的OpenAI兼容API客户端
+// 只发送各服务普遍支持的参数，适用于自建或未单独适配的服务
+type CompatibleClient struct {
+	BaseAIClient
+}
+
+// NewCompatibleClient 创建新的OpenAI兼容客户端
+func NewCompatibleClient() AIClient {
+	return &CompatibleClient{}
+}
+
+// BuildPrompt 构建OpenAI兼容API的请求数据
+func (c *CompatibleClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
+	content := c.GetPromptContent(codeContent, rules)
+	payload := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]interface{}{
+			{
+				"role":    "system",
+				"content": systemPrompt,
+			},
+			{
+				"role":    "user",
+				"content": content,
+			},
+		},
+		"temperature": 0.2,
+		"max_tokens":  maxTokens,
+		"stream":      false,
+	}
+
+	// json_schema并非所有服务都支持，只要求返回JSON对象，字段结构由提示词约束
+	if c.StructuredOutput() {
+		payload["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	return payload, nil
+}
+
+// ParseResponse 解析OpenAI兼容API的响应数据
+func (c *CompatibleClient) ParseResponse(responseData map[string]interface{}) (string, error) {
+	return parseChatCompletion(responseData)
+}
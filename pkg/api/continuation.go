@@ -0,0 +1,31 @@
+package api
+
+import "fmt"
+
+// FinishReasonLength 模型因达到max_tokens而停止输出时的结束原因
+const FinishReasonLength = "length"
+
+// continuationPrompt 要求模型接着被截断的回答继续输出的提示词
+const continuationPrompt = "你的回答因长度限制被截断了。请从中断的地方直接继续输出剩余内容，不要重复已经输出的部分，也不要添加任何说明。"
+
+// BuildContinuation 基于原请求构建续写请求：把已经输出的内容作为assistant消息，
+// 再追加一条要求继续输出的user消息，适用于OpenAI风格的messages格式
+func (c *BaseAIClient) BuildContinuation(payload map[string]interface{}, partial string) (map[string]interface{}, error) {
+	messages, ok := payload["messages"].([]map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload has no messages to continue")
+	}
+
+	next := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		next[k] = v
+	}
+	continued := make([]map[string]interface{}, 0, len(messages)+2)
+	continued = append(continued, messages...)
+	continued = append(continued,
+		map[string]interface{}{"role": "assistant", "content": partial},
+		map[string]interface{}{"role": "user", "content": continuationPrompt},
+	)
+	next["messages"] = continued
+	return next, nil
+}
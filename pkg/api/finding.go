@@ -0,0 +1,307 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 问题的严重级别
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+	SeverityInfo   = "info"
+)
+
+// NoIssuesFound 模型未发现问题时返回的文本
+const NoIssuesFound = "经过仔细审查，未发现任何问题。"
+
+// Finding 定义检查发现的单个问题
+type Finding struct {
+	Title       string `json:"title"`                // 问题标题
+	Severity    string `json:"severity"`             // 严重级别：high、medium、low、info
+	StartLine   int    `json:"start_line"`           // 起始行号，0表示未知
+	EndLine     int    `json:"end_line"`             // 结束行号，0表示未知
+	Description string `json:"description"`          // 问题的具体表现和影响
+	Suggestion  string `json:"suggestion,omitempty"` // 改进建议
+	FixedCode   string `json:"fixed_code,omitempty"` // 修正后的代码
+}
+
+// findingsResponse 结构化输出的整体结构
+type findingsResponse struct {
+	Findings []Finding `json:"findings"`
+}
+
+// FindingsSchema 返回结构化输出使用的JSON Schema
+func FindingsSchema() map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	integer := map[string]interface{}{"type": "integer"}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"findings": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"title": str,
+						"severity": map[string]interface{}{
+							"type": "string",
+							"enum": []string{SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo},
+						},
+						"start_line":  integer,
+						"end_line":    integer,
+						"description": str,
+						"suggestion":  str,
+						"fixed_code":  str,
+					},
+					"required":             []string{"title", "severity", "start_line", "end_line", "description", "suggestion", "fixed_code"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"findings"},
+		"additionalProperties": false,
+	}
+}
+
+// jsonFenceRe 匹配模型用代码块包裹的JSON
+var jsonFenceRe = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+
+// ParseFindings 解析模型返回的结构化JSON结果
+// 兼容 {"findings": [...]} 和直接返回数组两种形式，以及用```json代码块包裹的情况
+func ParseFindings(content string) ([]Finding, error) {
+	text := strings.TrimSpace(content)
+	if m := jsonFenceRe.FindStringSubmatch(text); m != nil && !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") {
+		text = strings.TrimSpace(m[1])
+	}
+
+	var findings []Finding
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &findings); err != nil {
+			return nil, fmt.Errorf("parse findings failed: %v", err)
+		}
+	} else {
+		// 截取第一个 { 到最后一个 } 之间的内容，忽略模型附带的说明文字
+		start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("no JSON object in response")
+		}
+		var resp findingsResponse
+		if err := json.Unmarshal([]byte(text[start:end+1]), &resp); err != nil {
+			return nil, fmt.Errorf("parse findings failed: %v", err)
+		}
+		findings = resp.Findings
+	}
+
+	for i := range findings {
+		findings[i].normalize()
+	}
+	return findings, nil
+}
+
+// normalize 规范化严重级别和行号
+func (f *Finding) normalize() {
+	f.Severity = normalizeSeverity(f.Severity)
+	if f.StartLine < 0 {
+		f.StartLine = 0
+	}
+	if f.EndLine < f.StartLine {
+		f.EndLine = f.StartLine
+	}
+}
+
+// normalizeSeverity 将模型返回的各种严重级别写法统一为标准值
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "high", "critical", "error", "严重", "高":
+		return SeverityHigh
+	case "medium", "中":
+		return SeverityMedium
+	case "low", "minor", "低":
+		return SeverityLow
+	case "info", "note", "提示", "建议":
+		return SeverityInfo
+	default:
+		return SeverityMedium
+	}
+}
+
+var (
+	// findingLineRe 匹配 "第12行"、"第12-20行"、"line 12"、"lines 12-20" 等行号描述
+	findingLineRe = regexp.MustCompile(`(?i)(?:第\s*(\d+)\s*(?:[-~～到至]\s*第?\s*(\d+)\s*)?行|lines?\s*(\d+)(?:\s*[-~]\s*(\d+))?)`)
+	// chunkHeadingRe 匹配多分片合并结果中的分隔标题
+	chunkHeadingRe = regexp.MustCompile(`^第\d+部分`)
+	// severityLabelRe 匹配标题开头的严重级别前缀，如 "[高]"
+	severityLabelRe = regexp.MustCompile(`^\[(高|中|低|提示)\]\s*`)
+	// highSeverityRe 标题中出现这些词时视为高严重级别
+	highSeverityRe = regexp.MustCompile(`(?i)严重|高危|致命|安全|漏洞|崩溃|critical|security`)
+	// lowSeverityRe 标题中出现这些词时视为低严重级别
+	lowSeverityRe = regexp.MustCompile(`(?i)建议|优化|风格|可读性|style|suggestion`)
+)
+
+// ParseMarkdownFindings 从Markdown格式的检查结果中解析问题，用于不支持JSON输出的服务
+// 每个二级标题(##)对应一个问题，引用(>)作为改进建议，代码块作为修正后的代码
+// 没有二级标题但有实际内容时，整段内容作为一个问题
+func ParseMarkdownFindings(content string) []Finding {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil
+	}
+
+	var findings []Finding
+	var current *Finding
+	var desc, suggestion, code strings.Builder
+	inCode := false
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Description = strings.TrimSpace(desc.String())
+		current.Suggestion = strings.TrimSpace(suggestion.String())
+		current.FixedCode = strings.TrimSpace(code.String())
+		findings = append(findings, *current)
+		current = nil
+		desc.Reset()
+		suggestion.Reset()
+		code.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			if current != nil {
+				code.WriteString(line)
+				code.WriteString("\n")
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "## ") {
+			flush()
+			title := strings.TrimSpace(strings.TrimPrefix(line, "## "))
+			// 多分片合并结果中的 "## 第N部分" 只是分隔标题，不是问题
+			if !chunkHeadingRe.MatchString(title) {
+				current = &Finding{Title: title}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, ">") {
+			suggestion.WriteString(strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+			suggestion.WriteString("\n")
+			continue
+		}
+		desc.WriteString(line)
+		desc.WriteString("\n")
+	}
+	flush()
+
+	if len(findings) == 0 {
+		if strings.Contains(content, "未发现任何问题") {
+			return nil
+		}
+		findings = []Finding{{Title: firstLine(content), Description: content}}
+	}
+
+	for i := range findings {
+		f := &findings[i]
+		f.Severity = SeverityMedium
+		if m := severityLabelRe.FindStringSubmatch(f.Title); m != nil {
+			// RenderFindingsMarkdown生成的标题带有 [高] 这样的级别前缀
+			f.Severity = normalizeSeverity(m[1])
+			f.Title = strings.TrimSpace(f.Title[len(m[0]):])
+		} else if highSeverityRe.MatchString(f.Title) {
+			f.Severity = SeverityHigh
+		} else if lowSeverityRe.MatchString(f.Title) {
+			f.Severity = SeverityLow
+		}
+		f.StartLine, f.EndLine = findLineRange(f.Title + "\n" + f.Description)
+	}
+	return findings
+}
+
+// findLineRange 从文本中查找第一个行号描述，找不到时返回0
+func findLineRange(text string) (start, end int) {
+	m := findingLineRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0, 0
+	}
+	startStr, endStr := m[1], m[2]
+	if startStr == "" {
+		startStr, endStr = m[3], m[4]
+	}
+	start, _ = strconv.Atoi(startStr)
+	end, _ = strconv.Atoi(endStr)
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// firstLine 返回文本的第一行，去掉Markdown标记
+func firstLine(text string) string {
+	line := strings.SplitN(text, "\n", 2)[0]
+	return strings.TrimSpace(strings.TrimLeft(line, "#>-* "))
+}
+
+// severityLabels 严重级别的中文名称
+var severityLabels = map[string]string{
+	SeverityHigh:   "高",
+	SeverityMedium: "中",
+	SeverityLow:    "低",
+	SeverityInfo:   "提示",
+}
+
+// SeverityLabel 返回严重级别的中文名称
+func SeverityLabel(severity string) string {
+	if label, ok := severityLabels[severity]; ok {
+		return label
+	}
+	return severity
+}
+
+// RenderFindingsMarkdown 将问题列表渲染为与非结构化输出一致的Markdown格式
+func RenderFindingsMarkdown(findings []Finding) string {
+	if len(findings) == 0 {
+		return NoIssuesFound
+	}
+
+	var b strings.Builder
+	for _, f := range findings {
+		b.WriteString(fmt.Sprintf("## [%s] %s", SeverityLabel(f.Severity), f.Title))
+		if f.StartLine > 0 {
+			if f.EndLine > f.StartLine {
+				b.WriteString(fmt.Sprintf("（第%d-%d行）", f.StartLine, f.EndLine))
+			} else {
+				b.WriteString(fmt.Sprintf("（第%d行）", f.StartLine))
+			}
+		}
+		b.WriteString("\n\n")
+		if f.Description != "" {
+			b.WriteString(f.Description)
+			b.WriteString("\n\n")
+		}
+		if f.Suggestion != "" {
+			for _, line := range strings.Split(f.Suggestion, "\n") {
+				b.WriteString("> ")
+				b.WriteString(line)
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if f.FixedCode != "" {
+			b.WriteString("```\n")
+			b.WriteString(f.FixedCode)
+			b.WriteString("\n```\n\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	Register(Provider{
+		Name:             "gemini",
+		Description:      "Google Gemini generateContent接口，url中的{model}会替换为模型名称",
+		New:              NewGeminiClient,
+		DefaultURL:       "https://generativelanguage.googleapis.com/v1beta/models/{model}:generateContent",
+		DefaultModel:     "gemini-2.5-flash",
+		DefaultMaxTokens: 8192,
+		KeyRequired:      true,
+	})
+}
+
+// geminiBlockedReasons 表示回答被安全策略拦截的finishReason
+var geminiBlockedReasons = map[string]bool{
+	"SAFETY":             true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+	"RECITATION":         true,
+	"IMAGE_SAFETY":       true,
+}
+
+// GeminiClient 实现Google Gemini API客户端
+type GeminiClient struct {
+	BaseAIClient
+}
+
+// NewGeminiClient 创建新的Gemini客户端
+func NewGeminiClient() AIClient {
+	return &GeminiClient{
+		BaseAIClient: BaseAIClient{
+			auth: HeaderAuth{Header: "x-goog-api-key"},
+		},
+	}
+}
+
+// BuildPrompt 构建Gemini API的请求数据
+// 模型由URL指定，审查说明和规则放在systemInstruction中，代码作为user内容
+func (c *GeminiClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
+	generationConfig := map[string]interface{}{
+		"maxOutputTokens": maxTokens,
+		"temperature":     0.2,
+	}
+	// 结构化输出时要求返回JSON，字段结构由提示词约束
+	if c.StructuredOutput() {
+		generationConfig["responseMimeType"] = "application/json"
+	}
+
+	return map[string]interface{}{
+		"systemInstruction": map[string]interface{}{
+			"parts": []map[string]interface{}{
+				{"text": systemPrompt + "\n\n" + c.GetPromptInstructions(rules)},
+			},
+		},
+		"contents": []map[string]interface{}{
+			{
+				"role": "user",
+				"parts": []map[string]interface{}{
+					{"text": c.GetCodePrompt(codeContent)},
+				},
+			},
+		},
+		"generationConfig": generationConfig,
+	}, nil
+}
+
+// ParseResponse 解析Gemini API的响应数据，拼接第一个候选回答中所有文本片段
+func (c *GeminiClient) ParseResponse(responseData map[string]interface{}) (string, error) {
+	if err := providerError(responseData); err != nil {
+		return "", err
+	}
+
+	// 提示词本身被拦截时没有候选回答，原因在promptFeedback中
+	if feedback, ok := responseData["promptFeedback"].(map[string]interface{}); ok {
+		if reason, _ := feedback["blockReason"].(string); reason != "" {
+			return "", &ResponseError{Kind: ResponseContentFilter, Message: "prompt blocked: " + reason}
+		}
+	}
+
+	candidates, ok := responseData["candidates"].([]interface{})
+	if !ok || len(candidates) == 0 {
+		return "", &ResponseError{Kind: ResponseEmptyChoices}
+	}
+	candidate, ok := candidates[0].(map[string]interface{})
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "candidate is not an object"}
+	}
+	if reason, _ := candidate["finishReason"].(string); geminiBlockedReasons[reason] {
+		return "", &ResponseError{Kind: ResponseContentFilter, Message: "response blocked: " + reason}
+	}
+
+	content, ok := candidate["content"].(map[string]interface{})
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "no content in candidate"}
+	}
+	parts, _ := content["parts"].([]interface{})
+	var b strings.Builder
+	for _, part := range parts {
+		p, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// 跳过思考过程
+		if thought, _ := p["thought"].(bool); thought {
+			continue
+		}
+		text, _ := p["text"].(string)
+		b.WriteString(text)
+	}
+	return b.String(), nil
+}
+
+// ParseFinishReason 读取第一个候选回答的finishReason，并换算为OpenAI风格的结束原因：MAX_TOKENS对应length，STOP对应stop
+func (c *GeminiClient) ParseFinishReason(responseData map[string]interface{}) string {
+	candidates, ok := responseData["candidates"].([]interface{})
+	if !ok || len(candidates) == 0 {
+		return ""
+	}
+	candidate, ok := candidates[0].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	reason, _ := candidate["finishReason"].(string)
+	switch reason {
+	case "MAX_TOKENS":
+		return FinishReasonLength
+	case "STOP":
+		return "stop"
+	}
+	return strings.ToLower(reason)
+}
+
+// BuildContinuation 构建续写请求：把已输出的内容作为model内容，再追加一条要求继续输出的user内容
+func (c *GeminiClient) BuildContinuation(payload map[string]interface{}, partial string) (map[string]interface{}, error) {
+	contents, ok := payload["contents"].([]map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload has no contents to continue")
+	}
+
+	next := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		next[k] = v
+	}
+	continued := make([]map[string]interface{}, 0, len(contents)+2)
+	continued = append(continued, contents...)
+	continued = append(continued,
+		map[string]interface{}{"role": "model", "parts": []map[string]interface{}{{"text": partial}}},
+		map[string]interface{}{"role": "user", "parts": []map[string]interface{}{{"text": continuationPrompt}}},
+	)
+	next["contents"] = continued
+	return next, nil
+}
@@ -0,0 +1,39 @@
+package api
+
+func init() {
+	Register(Provider{
+		Name:               "llamacpp",
+		Description:        "本地llama.cpp服务（llama-server）的OpenAI兼容接口，流式读取响应",
+		New:                NewLlamaCppClient,
+		DefaultURL:         "http://127.0.0.1:8080/v1/chat/completions",
+		DefaultModel:       "local",
+		DefaultMaxTokens:   4096,
+		DefaultTimeout:     600,
+		DefaultConcurrency: 1,
+	})
+}
+
+// LlamaCppClient 实现llama.cpp服务客户端，请求格式与通用OpenAI兼容客户端相同，但使用流式响应
+type LlamaCppClient struct {
+	CompatibleClient
+}
+
+// NewLlamaCppClient 创建新的llama.cpp客户端
+func NewLlamaCppClient() AIClient {
+	return &LlamaCppClient{
+		CompatibleClient: CompatibleClient{
+			BaseAIClient: BaseAIClient{stream: decodeSSEChatCompletion},
+		},
+	}
+}
+
+// BuildPrompt 构建llama.cpp服务的请求数据，llama.cpp只加载一个模型，model字段会被忽略
+func (c *LlamaCppClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
+	payload, err := c.CompatibleClient.BuildPrompt(codeContent, rules, model, maxTokens)
+	if err != nil {
+		return nil, err
+	}
+	payload["stream"] = true
+	payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	return payload, nil
+}
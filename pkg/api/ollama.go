@@ -0,0 +1,92 @@
+package api
+
+func init() {
+	Register(Provider{
+		Name:               "ollama",
+		Description:        "本地Ollama服务的/api/chat接口，流式读取响应，需要配置model",
+		New:                NewOllamaClient,
+		DefaultURL:         "http://127.0.0.1:11434/api/chat",
+		DefaultMaxTokens:   4096,
+		DefaultTimeout:     600,
+		DefaultConcurrency: 1,
+		DefaultContext:     defaultOllamaContext,
+	})
+}
+
+// defaultOllamaContext 未配置context_window时使用的num_ctx，Ollama自身的默认值较小，超出部分会被静默截断
+const defaultOllamaContext = 8192
+
+// OllamaClient 实现Ollama原生API客户端
+type OllamaClient struct {
+	BaseAIClient
+	contextWindow int
+}
+
+// NewOllamaClient 创建新的Ollama客户端
+func NewOllamaClient() AIClient {
+	return &OllamaClient{
+		BaseAIClient: BaseAIClient{stream: decodeOllamaStream},
+	}
+}
+
+// SetContextWindow 设置请求中options.num_ctx的值，0表示使用defaultOllamaContext，实现ContextWindowSetter
+func (c *OllamaClient) SetContextWindow(tokens int) {
+	c.contextWindow = tokens
+}
+
+// BuildPrompt 构建Ollama API的请求数据
+func (c *OllamaClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
+	numCtx := c.contextWindow
+	if numCtx <= 0 {
+		numCtx = defaultOllamaContext
+	}
+
+	payload := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]interface{}{
+			{
+				"role":    "system",
+				"content": systemPrompt,
+			},
+			{
+				"role":    "user",
+				"content": c.GetPromptContent(codeContent, rules),
+			},
+		},
+		"stream": true,
+		"options": map[string]interface{}{
+			"num_ctx":     numCtx,
+			"num_predict": maxTokens,
+			"temperature": 0.2,
+		},
+	}
+
+	// 结构化输出时要求返回JSON，字段结构由提示词约束
+	if c.StructuredOutput() {
+		payload["format"] = "json"
+	}
+
+	return payload, nil
+}
+
+// ParseResponse 解析Ollama API的响应数据
+func (c *OllamaClient) ParseResponse(responseData map[string]interface{}) (string, error) {
+	if err := providerError(responseData); err != nil {
+		return "", err
+	}
+	message, ok := responseData["message"].(map[string]interface{})
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "no message in response"}
+	}
+	content, ok := message["content"].(string)
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "no content in message"}
+	}
+	return content, nil
+}
+
+// ParseFinishReason 读取done_reason，达到num_predict时为length
+func (c *OllamaClient) ParseFinishReason(responseData map[string]interface{}) string {
+	reason, _ := responseData["done_reason"].(string)
+	return reason
+}
@@ -1,19 +1,36 @@
 package api
 
+func init() {
+	Register(Provider{
+		Name:             "openai",
+		Description:      "官方OpenAI接口",
+		New:              NewOpenAIClient,
+		DefaultURL:       "https://api.openai.com/v1/chat/completions",
+		DefaultModel:     "Pro/deepseek-ai/DeepSeek-R1", // 与旧版本保持一致
+		DefaultMaxTokens: 8192,
+		KeyRequired:      true,
+	})
+}
+
 // OpenAIClient 实现OpenAI API客户端
 type OpenAIClient struct {
 	BaseAIClient
 }
 
+// NewOpenAIClient 创建新的OpenAI客户端
+func NewOpenAIClient() AIClient {
+	return &OpenAIClient{}
+}
+
 // BuildPrompt 构建OpenAI API的请求数据
 func (c *OpenAIClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
 	content := c.GetPromptContent(codeContent, rules)
-	return map[string]interface{}{
+	payload := map[string]interface{}{
 		"model": model,
 		"messages": []map[string]interface{}{
 			{
 				"role":    "system",
-				"content": "你是一个专业的代码审计专家，擅长发现代码中的潜在问题和安全隐患。",
+				"content": systemPrompt,
 			},
 			{
 				"role":    "user",
@@ -25,30 +42,17 @@ func (c *OpenAIClient) BuildPrompt(codeContent string, rules []Rule, model strin
 		"top_p":             0.95,
 		"frequency_penalty": 0,
 		"presence_penalty":  0,
-	}, nil
-}
-
-// ParseResponse 解析OpenAI API的响应数据
-func (c *OpenAIClient) ParseResponse(responseData map[string]interface{}) (string, error) {
-	choices, ok := responseData["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "API返回结果格式错误", nil
-	}
-
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "API返回结果格式错误", nil
 	}
 
-	message, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return "API返回结果格式错误", nil
+	// 结构化输出时使用json_schema约束返回格式
+	if format := c.JSONSchemaResponseFormat(); format != nil {
+		payload["response_format"] = format
 	}
 
-	content, ok := message["content"].(string)
-	if !ok {
-		return "API返回结果格式错误", nil
-	}
+	return payload, nil
+}
 
-	return content, nil
+// ParseResponse 解析OpenAI API的响应数据
+func (c *OpenAIClient) ParseResponse(responseData map[string]interface{}) (string, error) {
+	return parseChatCompletion(responseData)
 }
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider 定义一个AI服务提供商：客户端的构造函数和各配置项的默认值
+type Provider struct {
+	Name             string          // 配置中api.type的取值
+	Description      string          // 在providers命令中显示的说明
+	New              func() AIClient // 创建客户端
+	DefaultURL       string          // 未配置api.url时使用的地址，为空表示必须配置
+	DefaultModel     string          // 未配置api.model时使用的模型，为空表示必须配置
+	DefaultMaxTokens int             // 未配置api.max_tokens时使用的值
+	KeyRequired      bool            // 是否必须配置api.key
+
+	DefaultTimeout     int // 未配置api.timeout时使用的值（秒），0表示使用全局默认值
+	DefaultConcurrency int // 未配置check.concurrency时使用的值，0表示使用全局默认值
+	DefaultContext     int // 未配置api.context_window时使用的值（tokens），0表示按内置模型目录确定
+}
+
+// providers 已注册的服务提供商
+var providers = make(map[string]Provider)
+
+// Register 注册服务提供商，重复注册同名提供商会覆盖之前的注册
+func Register(p Provider) {
+	providers[strings.ToLower(p.Name)] = p
+}
+
+// LookupProvider 根据名称查找服务提供商
+func LookupProvider(name string) (Provider, bool) {
+	p, ok := providers[strings.ToLower(name)]
+	return p, ok
+}
+
+// Providers 返回所有已注册的服务提供商，按名称排序
+func Providers() []Provider {
+	list := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// ProviderNames 返回所有已注册的服务提供商名称
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for _, p := range Providers() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// NewClient 根据服务提供商名称创建客户端
+func NewClient(name string) (AIClient, error) {
+	p, ok := LookupProvider(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s (available: %s)", name, strings.Join(ProviderNames(), ", "))
+	}
+	return p.New(), nil
+}
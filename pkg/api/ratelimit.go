@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// recoverAfterSuccesses 因限流降低并发后，连续成功多少次请求恢复一个并发
+const recoverAfterSuccesses = 10
+
+// RateLimiter 所有worker共享的限流器
+// 同时限制每分钟请求数（RPM）、每分钟token数（TPM）和同时进行的请求数，
+// 遇到429时将并发数减半并暂停所有请求，之后每连续成功若干次恢复一个并发
+type RateLimiter struct {
+	rpm            int // 每分钟最多请求数，0表示不限制
+	tpm            int // 每分钟最多token数，0表示不限制
+	maxConcurrency int // 并发数上限，0表示不限制
+
+	mu          sync.Mutex
+	requests    float64   // 请求令牌桶中剩余的请求数
+	tokens      float64   // token令牌桶中剩余的token数，实际用量超过估算时可能为负
+	last        time.Time // 上次补充令牌的时间
+	limit       int       // 当前允许的并发数
+	inFlight    int       // 进行中的请求数
+	successes   int       // 降低并发后连续成功的请求数
+	pausedUntil time.Time // 遇到429后暂停所有请求直到该时间
+	changed     chan struct{}
+}
+
+// NewRateLimiter 创建限流器，各参数为0表示不限制
+func NewRateLimiter(rpm, tpm, concurrency int) *RateLimiter {
+	return &RateLimiter{
+		rpm:            rpm,
+		tpm:            tpm,
+		maxConcurrency: concurrency,
+		requests:       float64(rpm),
+		tokens:         float64(tpm),
+		last:           time.Now(),
+		limit:          concurrency,
+		changed:        make(chan struct{}),
+	}
+}
+
+// Acquire 等待到可以发送一个估算消耗tokens个token的请求，返回请求结束后需要调用的release
+func (l *RateLimiter) Acquire(ctx context.Context, tokens int) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	for {
+		l.mu.Lock()
+		wait, ok := l.reserve(tokens, time.Now())
+		changed := l.changed
+		l.mu.Unlock()
+		if ok {
+			var once sync.Once
+			return func() { once.Do(l.release) }, nil
+		}
+
+		// wait为0表示在等待并发名额，只能等其他请求结束
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+		case <-changed:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reserve 尝试占用并发名额和令牌，失败时返回需要等待的时间，调用方需持有锁
+func (l *RateLimiter) reserve(tokens int, now time.Time) (time.Duration, bool) {
+	l.refill(now)
+
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now), false
+	}
+	if l.maxConcurrency > 0 && l.inFlight >= l.limit {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if l.rpm > 0 && l.requests < 1 {
+		wait = maxDuration(wait, time.Duration((1-l.requests)/float64(l.rpm)*float64(time.Minute)))
+	}
+	if l.tpm > 0 {
+		// 单个请求超过整分钟的配额时，等令牌桶满后放行，避免永远等待
+		need := float64(tokens)
+		if need > float64(l.tpm) {
+			need = float64(l.tpm)
+		}
+		if l.tokens < need {
+			wait = maxDuration(wait, time.Duration((need-l.tokens)/float64(l.tpm)*float64(time.Minute)))
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+
+	if l.rpm > 0 {
+		l.requests--
+	}
+	if l.tpm > 0 {
+		l.tokens -= float64(tokens)
+	}
+	l.inFlight++
+	return 0, true
+}
+
+// refill 按经过的时间补充令牌，调用方需持有锁
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last)
+	if elapsed <= 0 {
+		return
+	}
+	l.last = now
+	minutes := elapsed.Minutes()
+	if l.rpm > 0 {
+		l.requests = minFloat(float64(l.rpm), l.requests+minutes*float64(l.rpm))
+	}
+	if l.tpm > 0 {
+		l.tokens = minFloat(float64(l.tpm), l.tokens+minutes*float64(l.tpm))
+	}
+}
+
+// release 结束一个请求，释放并发名额
+func (l *RateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// notify 唤醒所有等待中的请求，调用方需持有锁
+func (l *RateLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Adjust 用实际用量修正请求前估算的token数，delta为实际值减去估算值
+func (l *RateLimiter) Adjust(delta int) {
+	if l == nil || l.tpm <= 0 || delta == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.tokens -= float64(delta)
+	l.notify()
+}
+
+// OnRateLimited 遇到429时调用：并发数减半（最少为1），并暂停所有请求pause时长
+func (l *RateLimiter) OnRateLimited(pause time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(pause); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.successes = 0
+	if l.maxConcurrency > 0 && l.limit > 1 {
+		l.limit = (l.limit + 1) / 2
+		fmt.Printf("检测到限流(429)，并发数降为 %d\n", l.limit)
+	}
+}
+
+// OnSuccess 请求成功时调用，降低并发后连续成功若干次恢复一个并发
+func (l *RateLimiter) OnSuccess() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit >= l.maxConcurrency {
+		return
+	}
+	l.successes++
+	if l.successes >= recoverAfterSuccesses {
+		l.successes = 0
+		l.limit++
+		fmt.Printf("请求恢复正常，并发数升为 %d\n", l.limit)
+		l.notify()
+	}
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBuckets(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		name     string
+		rpm, tpm int
+		tokens   []int         // 在t0依次请求的token数，都应立即放行
+		next     int           // 之后再请求的token数
+		wait     time.Duration // 该请求需要等待的时间
+	}{
+		{"rpm", 60, 0, []int{0, 0, 0}, 0, 0},
+		{"rpm exhausted", 3, 0, []int{0, 0, 0}, 0, 20 * time.Second},
+		{"tpm", 0, 1000, []int{600}, 400, 0},
+		{"tpm exhausted", 0, 1000, []int{600}, 600, 12 * time.Second},
+		{"both", 2, 1000, []int{100, 100}, 100, 30 * time.Second},
+		// 超过整分钟配额的请求等令牌桶满后放行，之后的请求等待超出的部分
+		{"oversized request", 0, 1000, []int{5000}, 100, 4*time.Minute + 6*time.Second},
+	} {
+		l := NewRateLimiter(tc.rpm, tc.tpm, 0)
+		l.last = t0
+		for i, tokens := range tc.tokens {
+			if wait, ok := l.reserve(tokens, t0); !ok {
+				t.Fatalf("%s: request %d waits %v, want allowed", tc.name, i, wait)
+			}
+		}
+		wait, ok := l.reserve(tc.next, t0)
+		if tc.wait == 0 {
+			if !ok {
+				t.Errorf("%s: next request waits %v, want allowed", tc.name, wait)
+			}
+			continue
+		}
+		if ok || wait.Round(time.Millisecond) != tc.wait {
+			t.Errorf("%s: next request wait = %v (allowed %v), want %v", tc.name, wait, ok, tc.wait)
+			continue
+		}
+		// 等待后令牌已补充，可以放行
+		if wait, ok := l.reserve(tc.next, t0.Add(tc.wait+time.Millisecond)); !ok {
+			t.Errorf("%s: request after waiting still waits %v", tc.name, wait)
+		}
+	}
+}
+
+func TestRateLimiterAdjust(t *testing.T) {
+	t0 := time.Now()
+	l := NewRateLimiter(0, 1000, 0)
+	l.last = t0
+	if _, ok := l.reserve(500, t0); !ok {
+		t.Fatal("first request not allowed")
+	}
+	// 实际用量比估算多400，剩余100
+	l.Adjust(400)
+	if wait, ok := l.reserve(200, l.last); ok || wait < 5*time.Second || wait > 7*time.Second {
+		t.Errorf("wait = %v (allowed %v), want about 6s after the adjustment", wait, ok)
+	}
+}
+
+func TestRateLimiterAdaptiveConcurrency(t *testing.T) {
+	l := NewRateLimiter(0, 0, 8)
+	for _, want := range []int{4, 2, 1, 1} {
+		l.OnRateLimited(0)
+		if l.limit != want {
+			t.Fatalf("limit after 429 = %d, want %d", l.limit, want)
+		}
+	}
+
+	// 连续成功10次恢复一个并发，中途遇到429重新计数
+	for i := 0; i < recoverAfterSuccesses-1; i++ {
+		l.OnSuccess()
+	}
+	if l.limit != 1 {
+		t.Fatalf("limit = %d before %d successes, want 1", l.limit, recoverAfterSuccesses)
+	}
+	l.OnSuccess()
+	if l.limit != 2 {
+		t.Fatalf("limit = %d after %d successes, want 2", l.limit, recoverAfterSuccesses)
+	}
+	for i := 0; i < recoverAfterSuccesses-1; i++ {
+		l.OnSuccess()
+	}
+	l.OnRateLimited(0)
+	for i := 0; i < recoverAfterSuccesses-1; i++ {
+		l.OnSuccess()
+	}
+	if l.limit != 1 {
+		t.Errorf("limit = %d, want the success count reset by the 429", l.limit)
+	}
+
+	// 不会超过配置的并发数
+	l = NewRateLimiter(0, 0, 2)
+	for i := 0; i < 3*recoverAfterSuccesses; i++ {
+		l.OnSuccess()
+	}
+	if l.limit != 2 {
+		t.Errorf("limit = %d, want at most the configured concurrency", l.limit)
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	l := NewRateLimiter(0, 0, 4)
+	l.OnRateLimited(time.Minute)
+	now := time.Now()
+	if wait, ok := l.reserve(0, now); ok || wait < 59*time.Second || wait > time.Minute {
+		t.Errorf("wait = %v (allowed %v), want the requests paused for about a minute", wait, ok)
+	}
+	if _, ok := l.reserve(0, now.Add(time.Minute+time.Second)); !ok {
+		t.Error("request not allowed after the pause")
+	}
+}
+
+func TestRateLimiterAcquire(t *testing.T) {
+	l := NewRateLimiter(0, 0, 1)
+	release, err := l.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发名额被占用时等待，释放后放行
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(context.Background(), 0)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second request acquired while the first is in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	release() // 重复调用只释放一次
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second request not released")
+	}
+
+	// 等待中的请求随ctx取消返回
+	release, _ = l.Acquire(context.Background(), 0)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, 0); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want the context error", err)
+	}
+
+	// 未配置限流器时直接放行
+	var none *RateLimiter
+	if release, err := none.Acquire(context.Background(), 100); err != nil {
+		t.Error(err)
+	} else {
+		release()
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ResponseErrorKind 响应内容错误的类别
+type ResponseErrorKind string
+
+const (
+	ResponseEmptyChoices  ResponseErrorKind = "empty_choices"  // 响应中没有choices
+	ResponseContentFilter ResponseErrorKind = "content_filter" // 触发了服务商的内容过滤
+	ResponseRefusal       ResponseErrorKind = "refusal"        // 模型拒绝回答
+	ResponseProviderError ResponseErrorKind = "provider_error" // 响应中带有服务商返回的error对象
+	ResponseMalformed     ResponseErrorKind = "malformed"      // 响应格式不符合预期
+)
+
+// ResponseError 表示HTTP请求成功但响应内容无法作为检查结果
+type ResponseError struct {
+	Kind    ResponseErrorKind
+	Message string // 服务商返回的错误信息或模型的拒绝说明
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("invalid API response (%s)", e.Kind)
+	}
+	return fmt.Sprintf("invalid API response (%s): %s", e.Kind, e.Message)
+}
+
+// Retryable 判断该错误是否可以重试
+// 空响应、格式错误和服务商错误通常是临时的；内容过滤和拒绝回答重试后结果相同
+func (e *ResponseError) Retryable() bool {
+	switch e.Kind {
+	case ResponseEmptyChoices, ResponseMalformed, ResponseProviderError:
+		return true
+	}
+	return false
+}
+
+// ErrorKind 返回错误的类别，用于失败清单：响应内容错误返回其类别，HTTP错误返回 "http_<状态码>"，其他错误返回空字符串
+func ErrorKind(err error) string {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return string(respErr.Kind)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("http_%d", apiErr.StatusCode)
+	}
+	return ""
+}
+
+// providerError 检查响应中服务商返回的error对象，部分服务在HTTP 200的响应中也会返回错误
+func providerError(responseData map[string]interface{}) error {
+	raw, ok := responseData["error"]
+	if !ok || raw == nil {
+		return nil
+	}
+	message := errorMessage(raw)
+	if message == "" {
+		return nil
+	}
+	return &ResponseError{Kind: ResponseProviderError, Message: message}
+}
+
+// errorMessage 从服务商的error字段中提取错误信息
+// 兼容 {"error": {"message": "...", "code": "..."}} 和 {"error": "..."} 两种形式
+func errorMessage(raw interface{}) string {
+	switch v := raw.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		message, _ := v["message"].(string)
+		code := v["code"]
+		if code == nil {
+			code = v["type"]
+		}
+		if code != nil && fmt.Sprint(code) != "" {
+			if message == "" {
+				return fmt.Sprint(code)
+			}
+			return fmt.Sprintf("%s (%v)", message, code)
+		}
+		return message
+	}
+	return ""
+}
+
+// bodyErrorMessage 从非200响应的内容中提取服务商的错误信息，无法解析时返回空字符串
+func bodyErrorMessage(body []byte) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+	if raw, ok := data["error"]; ok {
+		return errorMessage(raw)
+	}
+	message, _ := data["message"].(string)
+	return message
+}
+
+// parseChatCompletion 解析OpenAI兼容的chat completion响应，返回第一个choice的回答内容
+func parseChatCompletion(responseData map[string]interface{}) (string, error) {
+	if err := providerError(responseData); err != nil {
+		return "", err
+	}
+
+	choices, ok := responseData["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return "", &ResponseError{Kind: ResponseEmptyChoices}
+	}
+
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "choice is not an object"}
+	}
+	if reason, _ := choice["finish_reason"].(string); reason == "content_filter" {
+		return "", &ResponseError{Kind: ResponseContentFilter}
+	}
+
+	message, ok := choice["message"].(map[string]interface{})
+	if !ok {
+		return "", &ResponseError{Kind: ResponseMalformed, Message: "no message in choice"}
+	}
+	if refusal, _ := message["refusal"].(string); refusal != "" {
+		return "", &ResponseError{Kind: ResponseRefusal, Message: refusal}
+	}
+
+	switch content := message["content"].(type) {
+	case string:
+		return content, nil
+	case []interface{}:
+		// 部分服务以内容片段数组的形式返回
+		var b strings.Builder
+		for _, part := range content {
+			if p, ok := part.(map[string]interface{}); ok {
+				if text, ok := p["text"].(string); ok {
+					b.WriteString(text)
+				}
+			}
+		}
+		return b.String(), nil
+	}
+	return "", &ResponseError{Kind: ResponseMalformed, Message: "no content in message"}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy 定义API调用的重试策略
+type RetryPolicy struct {
+	MaxAttempts int     `json:"max_attempts"`  // 最大尝试次数（包含首次请求），1表示不重试
+	BaseDelayMs int     `json:"base_delay_ms"` // 首次重试的基础等待时间（毫秒），之后按指数增长
+	MaxDelayMs  int     `json:"max_delay_ms"`  // 单次等待的最大时间（毫秒）
+	Jitter      float64 `json:"jitter"`        // 随机抖动比例，取值0~1，0表示不抖动
+}
+
+// DefaultRetryPolicy 返回默认的重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelayMs: 2000,
+		MaxDelayMs:  60000,
+		Jitter:      0.2,
+	}
+}
+
+// normalize 补全未设置的字段
+func (p RetryPolicy) normalize() RetryPolicy {
+	def := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.BaseDelayMs <= 0 {
+		p.BaseDelayMs = def.BaseDelayMs
+	}
+	if p.MaxDelayMs <= 0 {
+		p.MaxDelayMs = def.MaxDelayMs
+	}
+	if p.MaxDelayMs < p.BaseDelayMs {
+		p.MaxDelayMs = p.BaseDelayMs
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+// backoff 计算第attempt次失败后的等待时间（attempt从1开始）
+// 如果服务端给出了建议等待时间，则以服务端为准，但不超过MaxDelayMs
+func (p RetryPolicy) backoff(attempt int, serverHint time.Duration) time.Duration {
+	maxDelay := time.Duration(p.MaxDelayMs) * time.Millisecond
+	if serverHint > 0 {
+		if serverHint > maxDelay {
+			return maxDelay
+		}
+		return serverHint
+	}
+
+	delay := float64(p.BaseDelayMs) * math.Pow(2, float64(attempt-1))
+	if delay > float64(p.MaxDelayMs) {
+		delay = float64(p.MaxDelayMs)
+	}
+	if p.Jitter > 0 {
+		// 在 [1-jitter, 1+jitter] 范围内随机浮动
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	d := time.Duration(delay) * time.Millisecond
+	if d > maxDelay {
+		d = maxDelay
+	}
+	return d
+}
+
+// Attempts 返回最大尝试次数，未设置时使用默认值
+func (p RetryPolicy) Attempts() int {
+	return p.normalize().MaxAttempts
+}
+
+// Delay 返回第attempt次失败后重新请求前的等待时间（attempt从1开始），未设置的字段使用默认值
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	return p.normalize().backoff(attempt, 0)
+}
+
+// APIError 表示API返回的非200响应
+type APIError struct {
+	StatusCode int           // HTTP状态码
+	Body       string        // 响应内容
+	Message    string        // 响应中服务商返回的错误信息，无法解析时为空
+	RetryAfter time.Duration // 服务端建议的等待时间，0表示未提供
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable 判断该错误是否可以重试
+func (e *APIError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// IsRetryable 判断一次API调用失败后是否值得重试
+// 可重试：429、408、5xx、网络超时和连接被重置等临时错误，以及空响应、服务商错误等响应内容错误
+// 不可重试：请求构造失败、鉴权失败、参数错误等4xx错误，DNS解析失败、证书错误等网络配置问题，以及内容过滤和拒绝回答
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.Retryable()
+	}
+
+	// 只有超时可以重试：DNS解析失败、证书错误、不支持的协议等配置问题同样实现了net.Error，重试也不会成功
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// 流式响应的空闲超时
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// 连接被重置或拒绝，以及响应在读完之前被关闭
+	for _, target := range retryableErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableErrors 可以重试的底层错误，Windows上连接被重置和拒绝的错误码为WSAECONNRESET(10054)和WSAECONNREFUSED(10061)
+var retryableErrors = []error{
+	syscall.ECONNRESET,
+	syscall.ECONNREFUSED,
+	syscall.Errno(10054),
+	syscall.Errno(10061),
+	io.ErrUnexpectedEOF,
+}
+
+// parseRetryAfter 从响应头中解析服务端建议的等待时间
+// 支持标准的Retry-After（秒数或HTTP日期）以及常见的限流头
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if v := header.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := t.Sub(now); d > 0 {
+				return d
+			}
+		}
+	}
+
+	// OpenAI兼容服务的限流重置时间，如 "1s"、"6m0s"、"20ms"
+	var longest time.Duration
+	for _, name := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens", "X-Ratelimit-Reset"} {
+		v := header.Get(name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			// 部分服务直接返回秒数
+			if secs, err2 := strconv.ParseFloat(v, 64); err2 == nil {
+				d = time.Duration(secs * float64(time.Second))
+			}
+		}
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
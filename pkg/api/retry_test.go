@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		hint     time.Duration
+		min, max time.Duration
+	}{
+		{"first retry", RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 10000}, 1, 0, 100 * time.Millisecond, 100 * time.Millisecond},
+		{"exponential", RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 10000}, 4, 0, 800 * time.Millisecond, 800 * time.Millisecond},
+		{"capped", RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 1000}, 10, 0, time.Second, time.Second},
+		{"jitter", RetryPolicy{BaseDelayMs: 1000, MaxDelayMs: 10000, Jitter: 0.2}, 2, 0, 1600 * time.Millisecond, 2400 * time.Millisecond},
+		{"jitter capped", RetryPolicy{BaseDelayMs: 1000, MaxDelayMs: 1000, Jitter: 0.5}, 3, 0, 500 * time.Millisecond, time.Second},
+		{"server hint", RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 10000, Jitter: 0.5}, 1, 3 * time.Second, 3 * time.Second, 3 * time.Second},
+		{"server hint capped", RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 2000}, 1, time.Minute, 2 * time.Second, 2 * time.Second},
+		{"defaults", RetryPolicy{}, 1, 0, 1600 * time.Millisecond, 2400 * time.Millisecond},
+	} {
+		policy := tc.policy.normalize()
+		for i := 0; i < 20; i++ {
+			if d := policy.backoff(tc.attempt, tc.hint); d < tc.min || d > tc.max {
+				t.Errorf("%s: backoff(%d) = %v, want %v~%v", tc.name, tc.attempt, d, tc.min, tc.max)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{"none", nil, 0},
+		{"seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second},
+		{"fractional seconds", map[string]string{"Retry-After": "1.5"}, 1500 * time.Millisecond},
+		{"http date", map[string]string{"Retry-After": now.Add(30 * time.Second).Format(http.TimeFormat)}, 30 * time.Second},
+		{"http date in the past", map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}, 0},
+		{"invalid", map[string]string{"Retry-After": "soon"}, 0},
+		{"milliseconds", map[string]string{"Retry-After-Ms": "250", "Retry-After": "7"}, 250 * time.Millisecond},
+		{"ratelimit reset", map[string]string{"X-Ratelimit-Reset-Requests": "1s", "X-Ratelimit-Reset-Tokens": "6m0s"}, 6 * time.Minute},
+		{"ratelimit reset seconds", map[string]string{"X-Ratelimit-Reset": "2"}, 2 * time.Second},
+	} {
+		header := http.Header{}
+		for name, value := range tc.header {
+			header.Set(name, value)
+		}
+		if got := parseRetryAfter(header, now); got != tc.want {
+			t.Errorf("%s: parseRetryAfter = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// timeoutError 模拟网络超时
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	// urlError 模拟http客户端返回的错误
+	urlError := func(err error) error {
+		return fmt.Errorf("API request failed: %w", &url.Error{Op: "Post", URL: "https://example.com/v1", Err: err})
+	}
+	syscallError := func(errno syscall.Errno) error {
+		return urlError(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)})
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"429", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"408", &APIError{StatusCode: http.StatusRequestTimeout}, true},
+		{"503", fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"401", &APIError{StatusCode: http.StatusUnauthorized}, false},
+		{"400", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"timeout", urlError(timeoutError{}), true},
+		{"connection reset", syscallError(syscall.ECONNRESET), true},
+		{"connection refused", syscallError(syscall.ECONNREFUSED), true},
+		{"connection reset on windows", syscallError(syscall.Errno(10054)), true},
+		{"unexpected EOF", urlError(io.ErrUnexpectedEOF), true},
+		{"no such host", urlError(&net.DNSError{Err: "no such host", Name: "api.example.invalid", IsNotFound: true}), false},
+		{"certificate", urlError(x509.UnknownAuthorityError{}), false},
+		{"unsupported scheme", urlError(errors.New(`unsupported protocol scheme "htps"`)), false},
+		{"message contains EOF", errors.New("invalid EOF marker in prompt"), false},
+	} {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	if got, want := (RetryPolicy{}).Attempts(), DefaultRetryPolicy().MaxAttempts; got != want {
+		t.Errorf("Attempts() = %d, want the default %d", got, want)
+	}
+	if got := (RetryPolicy{MaxAttempts: 2}).Attempts(); got != 2 {
+		t.Errorf("Attempts() = %d, want 2", got)
+	}
+	if d := (RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 250}).Delay(3); d != 250*time.Millisecond {
+		t.Errorf("Delay(3) = %v, want the capped delay", d)
+	}
+}
+
+func TestCallAPIMaxAttempts(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := &BaseAIClient{}
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelayMs: 1, MaxDelayMs: 1})
+	// 调用方限制的次数小于重试策略时按调用方的限制
+	ctx, info := WithCallInfo(context.Background())
+	info.MaxAttempts = 2
+	if _, err := c.CallAPI(ctx, map[string]interface{}{}, server.URL, "k"); err == nil {
+		t.Fatal("want the 503 error")
+	}
+	if calls != 2 || info.Attempts != 2 {
+		t.Errorf("sent %d requests (attempts %d), want 2", calls, info.Attempts)
+	}
+}
@@ -1,13 +1,37 @@
 package api
 
+func init() {
+	Register(Provider{
+		Name:             "siliconflow",
+		Description:      "SiliconFlow平台",
+		New:              NewSiliconflowClient,
+		DefaultURL:       "https://api.siliconflow.cn/v1/chat/completions",
+		DefaultModel:     "Pro/deepseek-ai/DeepSeek-R1",
+		DefaultMaxTokens: 8192,
+		KeyRequired:      true,
+	})
+}
+
 // SiliconflowClient 实现硅基流动 API 客户端
 type SiliconflowClient struct {
 	BaseAIClient
 }
 
+// NewSiliconflowClient 创建新的硅基流动客户端
+func NewSiliconflowClient() AIClient {
+	return &SiliconflowClient{}
+}
+
 // BuildPrompt 构建硅基流动 API 的请求数据
 func (c *SiliconflowClient) BuildPrompt(codeContent string, rules []Rule, model string, maxTokens int) (map[string]interface{}, error) {
 	content := c.GetPromptContent(codeContent, rules)
+
+	// 硅基流动只支持json_object，字段结构由提示词约束
+	responseType := "text"
+	if c.StructuredOutput() {
+		responseType = "json_object"
+	}
+
 	return map[string]interface{}{
 		"model": model,
 		"messages": []map[string]interface{}{
@@ -25,32 +49,12 @@ func (c *SiliconflowClient) BuildPrompt(codeContent string, rules []Rule, model
 		"frequency_penalty": 0.5,
 		"n":                 1,
 		"response_format": map[string]string{
-			"type": "text",
+			"type": responseType,
 		},
 	}, nil
 }
 
 // ParseResponse 解析硅基流动 API 的响应数据
 func (c *SiliconflowClient) ParseResponse(responseData map[string]interface{}) (string, error) {
-	choices, ok := responseData["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "API返回结果格式错误", nil
-	}
-
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "API返回结果格式错误", nil
-	}
-
-	message, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return "API返回结果格式错误", nil
-	}
-
-	content, ok := message["content"].(string)
-	if !ok {
-		return "API返回结果格式错误", nil
-	}
-
-	return content, nil
+	return parseChatCompletion(responseData)
 }
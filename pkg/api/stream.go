@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// streamDecoder 读取流式响应，聚合为与非流式响应结构相同的结果
+// 每收到一段数据调用一次touch，用于重置空闲超时
+type streamDecoder func(r io.Reader, touch func()) (map[string]interface{}, error)
+
+// maxStreamLine 流式响应中单行的最大长度
+const maxStreamLine = 1024 * 1024
+
+// decodeSSEChatCompletion 聚合OpenAI风格的SSE流式响应（data: {...}，以 data: [DONE] 结束），
+// 返回非流式chat completion的结构：choices[0].message.content、finish_reason、usage和model
+func decodeSSEChatCompletion(r io.Reader, touch func()) (map[string]interface{}, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+
+	var content strings.Builder
+	result := make(map[string]interface{})
+	finishReason := ""
+	for scanner.Scan() {
+		touch()
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("decode stream chunk failed: %w", err)
+		}
+		// 流中途出错时直接返回错误对象，由调用方按服务商错误处理
+		if _, ok := chunk["error"]; ok {
+			return chunk, nil
+		}
+		if model, ok := chunk["model"].(string); ok {
+			result["model"] = model
+		}
+		if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+			result["usage"] = usage
+		}
+		choices, _ := chunk["choices"].([]interface{})
+		if len(choices) == 0 {
+			continue
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		if delta, ok := choice["delta"].(map[string]interface{}); ok {
+			if text, ok := delta["content"].(string); ok {
+				content.WriteString(text)
+			}
+		}
+		if reason, ok := choice["finish_reason"].(string); ok && reason != "" {
+			finishReason = reason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stream failed: %w", err)
+	}
+
+	result["choices"] = []interface{}{
+		map[string]interface{}{
+			"message":       map[string]interface{}{"role": "assistant", "content": content.String()},
+			"finish_reason": finishReason,
+		},
+	}
+	return result, nil
+}
+
+// decodeOllamaStream 聚合Ollama /api/chat的流式响应（每行一个JSON对象，最后一行done为true），
+// 返回非流式响应的结构：message.content、done_reason、prompt_eval_count、eval_count和model
+func decodeOllamaStream(r io.Reader, touch func()) (map[string]interface{}, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+
+	var content strings.Builder
+	var last map[string]interface{}
+	for scanner.Scan() {
+		touch()
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, fmt.Errorf("decode stream chunk failed: %w", err)
+		}
+		if _, ok := chunk["error"]; ok {
+			return chunk, nil
+		}
+		if message, ok := chunk["message"].(map[string]interface{}); ok {
+			if text, ok := message["content"].(string); ok {
+				content.WriteString(text)
+			}
+		}
+		last = chunk
+		if done, _ := chunk["done"].(bool); done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stream failed: %w", err)
+	}
+	if last == nil {
+		return nil, fmt.Errorf("empty stream response")
+	}
+
+	// 最后一个对象带有结束原因和用量，用聚合后的内容替换其中的message
+	last["message"] = map[string]interface{}{"role": "assistant", "content": content.String()}
+	return last, nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import "unicode"
+
+// tokenizerFamily 定义一类分词器的近似换算比例
+// 不同模型的分词器对英文和中文的切分粒度差别很大，这里按字符类别分别估算
+type tokenizerFamily struct {
+	asciiCharsPerToken float64 // 平均多少个ASCII字符（含空白）对应一个token
+	cjkTokensPerChar   float64 // 每个中日韩字符平均对应多少个token
+	otherTokensPerChar float64 // 其他非ASCII字符平均对应多少个token
+}
+
+// tokenizerFamilies 各分词器家族的换算比例，未知模型使用default
+var tokenizerFamilies = map[string]tokenizerFamily{
+	"o200k":    {asciiCharsPerToken: 4.0, cjkTokensPerChar: 0.8, otherTokensPerChar: 0.6}, // GPT-4o、GPT-4.1、o系列
+	"cl100k":   {asciiCharsPerToken: 3.8, cjkTokensPerChar: 1.3, otherTokensPerChar: 0.8}, // GPT-4、GPT-3.5
+	"claude":   {asciiCharsPerToken: 3.4, cjkTokensPerChar: 1.2, otherTokensPerChar: 0.8},
+	"gemini":   {asciiCharsPerToken: 4.0, cjkTokensPerChar: 0.8, otherTokensPerChar: 0.6},
+	"deepseek": {asciiCharsPerToken: 3.6, cjkTokensPerChar: 0.6, otherTokensPerChar: 0.6},
+	"qwen":     {asciiCharsPerToken: 3.6, cjkTokensPerChar: 0.7, otherTokensPerChar: 0.6},
+	"doubao":   {asciiCharsPerToken: 3.6, cjkTokensPerChar: 0.7, otherTokensPerChar: 0.6},
+	"llama":    {asciiCharsPerToken: 3.8, cjkTokensPerChar: 1.0, otherTokensPerChar: 0.8},
+	"default":  {asciiCharsPerToken: 3.5, cjkTokensPerChar: 1.0, otherTokensPerChar: 0.8}, // 偏保守，宁可多估
+}
+
+// EstimateTokens 估算文本在指定模型下的token数，未知模型按偏保守的默认比例估算
+func EstimateTokens(model, text string) int {
+	family := "default"
+	if info, ok := LookupModel(model); ok {
+		family = info.Tokenizer
+	}
+	return estimateTokens(family, text)
+}
+
+// TokenCounter 返回指定模型的token估算函数，避免每次估算都重新查找模型
+func TokenCounter(model string) func(string) int {
+	family := "default"
+	if info, ok := LookupModel(model); ok {
+		family = info.Tokenizer
+	}
+	return func(text string) int {
+		return estimateTokens(family, text)
+	}
+}
+
+// estimateTokens 按分词器家族估算token数
+func estimateTokens(family, text string) int {
+	f, ok := tokenizerFamilies[family]
+	if !ok {
+		f = tokenizerFamilies["default"]
+	}
+
+	ascii, cjk, other := 0, 0, 0
+	for _, r := range text {
+		switch {
+		case r < 0x80:
+			ascii++
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			cjk++
+		default:
+			other++
+		}
+	}
+
+	tokens := float64(ascii)/f.asciiCharsPerToken + float64(cjk)*f.cjkTokensPerChar + float64(other)*f.otherTokensPerChar
+	if tokens > 0 && tokens < 1 {
+		return 1
+	}
+	return int(tokens + 0.5)
+}
+
+// PromptOverheadTokens 估算提示词中代码以外部分（审查说明、输出格式、规则描述）的token数
+func PromptOverheadTokens(model string, rules []Rule, structured, lineNumbers bool) int {
+	c := BaseAIClient{structured: structured, lineNumbers: lineNumbers}
+	return EstimateTokens(model, c.GetPromptContent("", rules))
+}
+
+// EstimateTokens 按该模型的分词器家族估算文本的token数
+func (m ModelInfo) EstimateTokens(text string) int {
+	return estimateTokens(m.Tokenizer, text)
+}
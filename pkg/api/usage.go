@@ -0,0 +1,71 @@
+package api
+
+// Usage 定义一次API调用消耗的token数
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`     // 输入token数
+	CompletionTokens int `json:"completion_tokens"` // 输出token数
+	TotalTokens      int `json:"total_tokens"`      // 总token数
+}
+
+// Add 累加另一次调用的用量
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// IsZero 判断是否没有任何用量，服务未返回usage时为true
+func (u Usage) IsZero() bool {
+	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0
+}
+
+// ParseUsage 从响应的usage字段中读取token用量，没有该字段时返回零值
+// 兼容OpenAI风格的prompt_tokens/completion_tokens和Anthropic风格的input_tokens/output_tokens，
+// Anthropic的缓存读写token也计入输入；Gemini的用量在usageMetadata中，思考过程的token计入输出；
+// Ollama的用量在顶层的prompt_eval_count/eval_count中
+func (c *BaseAIClient) ParseUsage(responseData map[string]interface{}) Usage {
+	if metadata, ok := responseData["usageMetadata"].(map[string]interface{}); ok {
+		return Usage{
+			PromptTokens:     intField(metadata, "promptTokenCount"),
+			CompletionTokens: intField(metadata, "candidatesTokenCount") + intField(metadata, "thoughtsTokenCount"),
+			TotalTokens:      intField(metadata, "totalTokenCount"),
+		}
+	}
+
+	// Ollama原生接口的用量在顶层
+	if _, ok := responseData["eval_count"]; ok {
+		u := Usage{
+			PromptTokens:     intField(responseData, "prompt_eval_count"),
+			CompletionTokens: intField(responseData, "eval_count"),
+		}
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		return u
+	}
+
+	usage, ok := responseData["usage"].(map[string]interface{})
+	if !ok {
+		return Usage{}
+	}
+	u := Usage{
+		PromptTokens:     intField(usage, "prompt_tokens"),
+		CompletionTokens: intField(usage, "completion_tokens"),
+		TotalTokens:      intField(usage, "total_tokens"),
+	}
+	if _, ok := usage["input_tokens"]; ok {
+		u.PromptTokens = intField(usage, "input_tokens") +
+			intField(usage, "cache_creation_input_tokens") + intField(usage, "cache_read_input_tokens")
+		u.CompletionTokens = intField(usage, "output_tokens")
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return u
+}
+
+// intField 读取JSON对象中的整数字段，JSON解码后的数字为float64
+func intField(m map[string]interface{}, key string) int {
+	if v, ok := m[key].(float64); ok {
+		return int(v)
+	}
+	return 0
+}
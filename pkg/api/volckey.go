@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 方舟控制面获取API Key的接口，与官方SDK的参数一致
+const (
+	volcOpenAPIURL       = "https://open.volcengineapi.com/?Action=GetApiKey&Version=2024-01-01"
+	volcAPIKeyDuration   = 7 * 24 * time.Hour // 申请的API Key有效期
+	volcAPIKeyRefreshGap = 30 * time.Minute   // 距离过期不足该时间时重新申请
+)
+
+// VolcKeyAuth 使用火山引擎Access Key/Secret Key向方舟控制面申请推理接入点的临时API Key，
+// 再以 "Authorization: Bearer <key>" 鉴权，与官方SDK使用AK/SK时的流程一致。
+// API Key在过期前缓存复用，多个并发请求共享同一个Key
+type VolcKeyAuth struct {
+	signer     *VolcSigner
+	endpointID string // 推理接入点ID（ep-开头），即api.model
+	openAPIURL string // 控制面地址，测试时替换
+
+	mu      sync.Mutex
+	key     string
+	expires time.Time
+}
+
+// NewVolcKeyAuth 创建AK/SK鉴权，endpointID为方舟推理接入点ID，region为空时使用默认地域
+func NewVolcKeyAuth(accessKey, secretKey, region, endpointID string) *VolcKeyAuth {
+	return &VolcKeyAuth{
+		signer:     NewVolcSigner(accessKey, secretKey, region, VolcDefaultService),
+		endpointID: endpointID,
+		openAPIURL: volcOpenAPIURL,
+	}
+}
+
+// Authenticate 添加Authorization请求头，首次调用或Key即将过期时先申请新的API Key，apiKey不使用
+func (a *VolcKeyAuth) Authenticate(req *http.Request, body []byte, apiKey string) error {
+	key, err := a.apiKey(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	return nil
+}
+
+// apiKey 返回缓存的API Key，即将过期时重新申请
+func (a *VolcKeyAuth) apiKey(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.key != "" && time.Until(a.expires) > volcAPIKeyRefreshGap {
+		return a.key, nil
+	}
+
+	key, expires, err := a.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	a.key, a.expires = key, expires
+	return key, nil
+}
+
+// fetch 调用GetApiKey接口申请API Key，请求使用AK/SK签名
+func (a *VolcKeyAuth) fetch(ctx context.Context) (string, time.Time, error) {
+	if !strings.HasPrefix(a.endpointID, "ep-") {
+		return "", time.Time{}, fmt.Errorf("volc sign requires an endpoint id (ep-...) as model, got %q", a.endpointID)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"DurationSeconds": int(volcAPIKeyDuration / time.Second),
+		"ResourceType":    "endpoint",
+		"ResourceIds":     []string{a.endpointID},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.openAPIURL, bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("create GetApiKey request failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if err := a.signer.Authenticate(req, body, ""); err != nil {
+		return "", time.Time{}, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("GetApiKey request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("read GetApiKey response failed: %w", err)
+	}
+
+	var result struct {
+		ResponseMetadata struct {
+			Error *struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Error"`
+		} `json:"ResponseMetadata"`
+		Result struct {
+			APIKey      string `json:"ApiKey"`
+			ExpiredTime int64  `json:"ExpiredTime"`
+		} `json:"Result"`
+	}
+	jsonErr := json.Unmarshal(data, &result)
+	if resp.StatusCode != http.StatusOK {
+		// 鉴权失败等4xx错误不重试，限流和5xx按临时错误重试
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(data),
+			RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+		}
+		if jsonErr == nil && result.ResponseMetadata.Error != nil {
+			apiErr.Message = fmt.Sprintf("GetApiKey %s: %s", result.ResponseMetadata.Error.Code, result.ResponseMetadata.Error.Message)
+		}
+		return "", time.Time{}, apiErr
+	}
+	if jsonErr != nil {
+		return "", time.Time{}, fmt.Errorf("decode GetApiKey response failed: %w", jsonErr)
+	}
+	if e := result.ResponseMetadata.Error; e != nil {
+		return "", time.Time{}, fmt.Errorf("GetApiKey failed: %s: %s", e.Code, e.Message)
+	}
+	if result.Result.APIKey == "" {
+		return "", time.Time{}, fmt.Errorf("GetApiKey returned no api key")
+	}
+	// 没有返回过期时间时按申请的有效期计算，避免每个请求都重新申请
+	expires := time.Now().Add(volcAPIKeyDuration)
+	if result.Result.ExpiredTime > 0 {
+		expires = time.Unix(result.Result.ExpiredTime, 0)
+	}
+	return result.Result.APIKey, expires, nil
+}
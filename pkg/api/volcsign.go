@@ -0,0 +1,153 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 火山引擎签名的默认地域和服务，对应方舟大模型服务
+const (
+	VolcDefaultRegion  = "cn-beijing"
+	VolcDefaultService = "ark"
+)
+
+// VolcSigner 使用火山引擎Access Key/Secret Key对请求签名（HMAC-SHA256），与官方SDK的签名算法一致
+type VolcSigner struct {
+	AccessKey string
+	SecretKey string
+	Region    string
+	Service   string
+
+	now func() time.Time // 签名时间，为nil时使用当前时间
+}
+
+// NewVolcSigner 创建火山引擎请求签名，region和service为空时使用方舟的默认值
+func NewVolcSigner(accessKey, secretKey, region, service string) *VolcSigner {
+	if region == "" {
+		region = VolcDefaultRegion
+	}
+	if service == "" {
+		service = VolcDefaultService
+	}
+	return &VolcSigner{AccessKey: accessKey, SecretKey: secretKey, Region: region, Service: service}
+}
+
+// Authenticate 为请求添加X-Date、X-Content-Sha256和Authorization请求头，apiKey不使用
+// 每次发送（包括重试）都会重新签名，签名时间与请求时间一致
+func (s *VolcSigner) Authenticate(req *http.Request, body []byte, apiKey string) error {
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return fmt.Errorf("volc sign requires access key and secret key")
+	}
+
+	t := time.Now()
+	if s.now != nil {
+		t = s.now()
+	}
+	xDate := t.UTC().Format("20060102T150405Z")
+	shortDate := xDate[:8]
+	payloadHash := hashHex(body)
+
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	}
+	req.Header.Set("X-Date", xDate)
+	req.Header.Set("X-Content-Sha256", payloadHash)
+
+	// 规范请求：Content-Type、Content-Md5、Host以及所有X-开头的请求头参与签名
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": volcHost(host)} // Go的http客户端使用req.Host发送Host请求头
+	for name := range req.Header {
+		switch name {
+		case "Content-Type", "Content-Md5":
+		default:
+			if !strings.HasPrefix(name, "X-") {
+				continue
+			}
+		}
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		volcPath(path),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	// 待签名字符串和签名
+	credentialScope := strings.Join([]string{shortDate, s.Region, s.Service, "request"}, "/")
+	stringToSign := strings.Join([]string{"HMAC-SHA256", xDate, credentialScope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte(s.SecretKey), shortDate)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, credentialScope, signedHeaders, signature))
+	return nil
+}
+
+// volcHost 去掉Host中的默认端口80和443
+func volcHost(host string) string {
+	if h, port, err := net.SplitHostPort(host); err == nil && (port == "80" || port == "443") {
+		return h
+	}
+	return host
+}
+
+// volcPath 逐段编码路径，除字母、数字和 -_.~ 外的字符都编码为大写的%XX
+func volcPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for j := 0; j < len(segment); j++ {
+			c := segment[j]
+			if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
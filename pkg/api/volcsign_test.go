@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 期望的签名由火山引擎官方SDK（volc-sdk-golang v1.0.23，base.Sign4）对相同请求计算得到
+func TestVolcSignerKnownAnswer(t *testing.T) {
+	signTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		name        string
+		method, url string
+		contentType string
+		body        string
+		headers     map[string]string
+		want        string
+	}{
+		{
+			name:        "GetApiKey",
+			method:      "POST",
+			url:         "https://open.volcengineapi.com/?Action=GetApiKey&Version=2024-01-01",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"DurationSeconds":604800,"ResourceIds":["ep-20240101000000-abcde"],"ResourceType":"endpoint"}`,
+			want:        "HMAC-SHA256 Credential=AKLTtest/20240102/cn-beijing/ark/request, SignedHeaders=content-type;host;x-content-sha256;x-date, Signature=400e6d234e05bd800bf1209788ae6b13610e611e8e642c970d725a0b2d10e27f",
+		},
+		{
+			// 默认端口、路径编码、查询参数排序和空格编码、额外的X-请求头
+			name:    "canonicalization",
+			method:  "GET",
+			url:     "https://example.com:443/a b/c~d?b=2&a=x+y&a=1",
+			headers: map[string]string{"X-Custom": " v ", "Accept": "*/*"},
+			want:    "HMAC-SHA256 Credential=AKLTtest/20240102/cn-beijing/ark/request, SignedHeaders=content-type;host;x-content-sha256;x-custom;x-date, Signature=6578a91035a614823b75f5dfbde7f710c4fd16bae6a150797ed78ceaab2db769",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			s := NewVolcSigner("AKLTtest", "c2VjcmV0", "", "")
+			s.now = func() time.Time { return signTime }
+			if err := s.Authenticate(req, []byte(tc.body), ""); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("Authorization"); got != tc.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVolcKeyAuth(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		n := len(requests)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"ResponseMetadata":{"Action":"GetApiKey"},"Result":{"ApiKey":"key-%d","ExpiredTime":%d}}`,
+			n, time.Now().Add(volcAPIKeyDuration).Unix())
+	}))
+	defer server.Close()
+
+	auth := NewVolcKeyAuth("AKLTtest", "c2VjcmV0", "", "ep-test")
+	auth.openAPIURL = server.URL + "/?Action=GetApiKey&Version=2024-01-01"
+
+	// 并发请求只申请一次API Key
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequestWithContext(context.Background(), "POST", "https://ark.example.com/chat", bytes.NewReader(nil))
+			if err := auth.Authenticate(req, nil, ""); err != nil {
+				t.Error(err)
+				return
+			}
+			if got := req.Header.Get("Authorization"); got != "Bearer key-1" {
+				t.Errorf("Authorization = %q, want the exchanged api key", got)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(requests) != 1 {
+		t.Fatalf("GetApiKey called %d times, want 1", len(requests))
+	}
+
+	r := requests[0]
+	if r.Method != "POST" || r.URL.Query().Get("Action") != "GetApiKey" || r.URL.Query().Get("Version") != "2024-01-01" {
+		t.Errorf("request = %s %s", r.Method, r.URL)
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "HMAC-SHA256 Credential=AKLTtest/") || !strings.Contains(r.Header.Get("Authorization"), "/cn-beijing/ark/request") {
+		t.Errorf("GetApiKey request not signed: %q", r.Header.Get("Authorization"))
+	}
+	if ids, _ := bodies[0]["ResourceIds"].([]interface{}); len(ids) != 1 || ids[0] != "ep-test" || bodies[0]["ResourceType"] != "endpoint" {
+		t.Errorf("GetApiKey body = %v", bodies[0])
+	}
+
+	// 即将过期时重新申请
+	auth.expires = time.Now().Add(volcAPIKeyRefreshGap / 2)
+	req, _ := http.NewRequest("POST", "https://ark.example.com/chat", nil)
+	if err := auth.Authenticate(req, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer key-2" || len(requests) != 2 {
+		t.Errorf("Authorization = %q after %d calls, want a refreshed key", got, len(requests))
+	}
+}
+
+func TestVolcKeyAuthError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"ResponseMetadata":{"Error":{"Code":"AccessDenied","Message":"no permission"}}}`)
+	}))
+	defer server.Close()
+
+	auth := NewVolcKeyAuth("AKLTtest", "c2VjcmV0", "", "ep-test")
+	auth.openAPIURL = server.URL
+	req, _ := http.NewRequest("POST", "https://ark.example.com/chat", nil)
+	err := auth.Authenticate(req, nil, "")
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusForbidden || apiErr.Retryable() || !strings.Contains(apiErr.Error(), "AccessDenied") {
+		t.Fatalf("err = %v, want a non-retryable APIError with the GetApiKey error", err)
+	}
+}
+
+func TestVolcKeyAuthWithoutExpiredTime(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		fmt.Fprint(w, `{"ResponseMetadata":{"Action":"GetApiKey"},"Result":{"ApiKey":"key"}}`)
+	}))
+	defer server.Close()
+
+	// 没有返回过期时间时按申请的有效期缓存，不会每次请求都重新申请
+	auth := NewVolcKeyAuth("AKLTtest", "c2VjcmV0", "", "ep-test")
+	auth.openAPIURL = server.URL
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", "https://ark.example.com/chat", nil)
+		if err := auth.Authenticate(req, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("GetApiKey called %d times, want 1", calls)
+	}
+	if d := time.Until(auth.expires); d < volcAPIKeyDuration-time.Minute || d > volcAPIKeyDuration {
+		t.Errorf("key expires in %v, want the requested duration", d)
+	}
+}
@@ -0,0 +1,91 @@
+package checker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+)
+
+// Budget 定义一次运行的资源上限，任一上限为0表示不限制
+// 达到上限后停止派发新任务，进行中的任务会继续完成，因此实际用量可能略超过上限
+type Budget struct {
+	MaxTokens  int     `json:"max_tokens"`  // 最多消耗的token总数（输入+输出）
+	MaxCost    float64 `json:"max_cost"`    // 最多花费的估算费用，币种与模型目录中的价格一致
+	MaxMinutes int     `json:"max_minutes"` // 从开始检查算起，超过该时间（分钟）后不再派发新任务
+}
+
+// budgetTracker 统计本次运行的用量并判断是否达到预算上限，可被多个worker并发使用
+type budgetTracker struct {
+	budget   Budget
+	model    api.ModelInfo
+	priced   bool // 模型是否在内置目录中，不在时无法计算费用
+	deadline time.Time
+
+	mu        sync.Mutex
+	usage     api.Usage
+	cost      float64
+	estimated int // 服务未返回usage、按估算值计入的调用次数
+}
+
+// newBudgetTracker 创建预算统计，start为本次检查的开始时间
+func newBudgetTracker(budget Budget, model string, start time.Time) *budgetTracker {
+	t := &budgetTracker{budget: budget}
+	t.model, t.priced = api.LookupModel(model)
+	if budget.MaxMinutes > 0 {
+		t.deadline = start.Add(time.Duration(budget.MaxMinutes) * time.Minute)
+	}
+	return t
+}
+
+// add 计入一次API调用的用量，estimated表示用量是估算的
+func (t *budgetTracker) add(usage api.Usage, estimated bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.Add(usage)
+	if t.priced {
+		t.cost += t.model.Cost(usage.PromptTokens, usage.CompletionTokens)
+	}
+	if estimated {
+		t.estimated++
+	}
+}
+
+// exceeded 返回达到的预算上限的描述，未达到任何上限时返回空字符串
+func (t *budgetTracker) exceeded() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.budget.MaxTokens > 0 && t.usage.TotalTokens >= t.budget.MaxTokens:
+		return fmt.Sprintf("token用量 %d 达到上限 %d", t.usage.TotalTokens, t.budget.MaxTokens)
+	case t.budget.MaxCost > 0 && t.priced && t.cost >= t.budget.MaxCost:
+		return fmt.Sprintf("估算费用 %.4f %s 达到上限 %.4f", t.cost, t.model.Currency, t.budget.MaxCost)
+	case !t.deadline.IsZero() && !time.Now().Before(t.deadline):
+		return fmt.Sprintf("运行时间达到上限 %d 分钟", t.budget.MaxMinutes)
+	}
+	return ""
+}
+
+// summary 返回本次运行用量的描述
+func (t *budgetTracker) summary() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := fmt.Sprintf("token用量: %d（输入 %d，输出 %d）", t.usage.TotalTokens, t.usage.PromptTokens, t.usage.CompletionTokens)
+	if t.priced {
+		s += fmt.Sprintf("，估算费用: %.4f %s", t.cost, t.model.Currency)
+	}
+	if t.estimated > 0 {
+		s += fmt.Sprintf("（其中 %d 次调用服务未返回用量，按估算值计入）", t.estimated)
+	}
+	return s
+}
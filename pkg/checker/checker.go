@@ -1,12 +1,14 @@
 package checker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zx2/code-checker/pkg/api"
@@ -27,6 +29,22 @@ type CodeChecker struct {
 	svnFilterAfter     *time.Time
 	concurrency        int
 	apiClient          api.AIClient
+	continueOnError    bool
+	retryFailed        bool
+	shutdownGrace      time.Duration
+	outputLayout       string
+	formats            []string
+	lineNumbers        bool
+	chunkStrategy      string
+	chunkOverlap       int
+	chunkContextHeader bool
+	maxChunkTokens     int
+	contextWindow      int
+	budget             Budget
+	maxContinuations   int
+	retryPolicy        api.RetryPolicy
+	tracker            *budgetTracker // 本次运行的预算统计，CheckDirectory开始时创建
+	stats              *runStats      // 本次运行每次API调用的统计，CheckDirectory开始时创建
 }
 
 // NewCodeChecker 创建新的代码检查器
@@ -42,52 +60,135 @@ func NewCodeChecker(rules []api.Rule, apiURL, apiKey, apiModel string, maxTextLe
 		svnPriorityAuthors: svnPriorityAuthors,
 		svnFilterAfter:     svnFilterAfter,
 		concurrency:        concurrency,
+		outputLayout:       formatter.LayoutBasename,
 		apiClient:          apiClient,
 	}, nil
 }
 
-// splitCodeContent 将代码内容按行分片
-func (c *CodeChecker) splitCodeContent(content string) []string {
-	if len(content) <= c.maxTextLength {
-		return []string{content}
-	}
+// SetContinueOnError 设置单个任务失败时是否继续检查其他任务
+func (c *CodeChecker) SetContinueOnError(enable bool) {
+	c.continueOnError = enable
+}
 
-	lines := strings.Split(content, "\n")
-	var chunks []string
-	var currentChunk strings.Builder
-	lineCount := 0
+// SetRetryFailed 设置是否只重新执行上次失败清单中的任务
+func (c *CodeChecker) SetRetryFailed(enable bool) {
+	c.retryFailed = enable
+}
 
-	for _, line := range lines {
-		// 如果当前分片加上新行会超过最大长度，就开始新的分片
-		if currentChunk.Len()+len(line)+1 > c.maxTextLength && currentChunk.Len() > 0 {
-			chunks = append(chunks, currentChunk.String())
-			currentChunk.Reset()
-			lineCount = 0
-		}
+// SetShutdownGrace 设置停止派发任务后等待进行中任务完成的最长时间，0表示一直等待
+func (c *CodeChecker) SetShutdownGrace(grace time.Duration) {
+	c.shutdownGrace = grace
+}
 
-		// 添加新行到当前分片
-		if currentChunk.Len() > 0 {
-			currentChunk.WriteString("\n")
-		}
-		currentChunk.WriteString(line)
-		lineCount++
+// SetOutputLayout 设置报告文件的目录布局，见formatter.Layout*，为空时使用basename
+func (c *CodeChecker) SetOutputLayout(layout string) {
+	if layout == "" {
+		layout = formatter.LayoutBasename
 	}
+	c.outputLayout = layout
+}
 
-	// 添加最后一个分片
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, currentChunk.String())
-	}
+// SetFormats 设置同时输出的报告格式，为空时只输出markdown
+func (c *CodeChecker) SetFormats(formats []string) {
+	c.formats = formats
+}
+
+// SetLineNumbers 设置发送给API的代码是否带有行号前缀
+func (c *CodeChecker) SetLineNumbers(enable bool) {
+	c.lineNumbers = enable
+}
+
+// SetChunkOptions 设置分片策略、相邻分片重叠的行数，以及是否在分片前加上外层函数/类的签名
+func (c *CodeChecker) SetChunkOptions(strategy string, overlap int, contextHeader bool) {
+	c.chunkStrategy = strategy
+	c.chunkOverlap = overlap
+	c.chunkContextHeader = contextHeader
+}
+
+// SetMaxChunkTokens 设置单个分片的最大token数，0表示根据模型的上下文窗口自动计算
+func (c *CodeChecker) SetMaxChunkTokens(tokens int) {
+	c.maxChunkTokens = tokens
+}
+
+// SetContextWindow 设置模型的上下文窗口大小（tokens），用于计算分片大小，0表示使用内置模型目录中的值
+func (c *CodeChecker) SetContextWindow(tokens int) {
+	c.contextWindow = tokens
+}
+
+// SetBudget 设置本次运行的token、费用和时间上限
+func (c *CodeChecker) SetBudget(budget Budget) {
+	c.budget = budget
+}
+
+// SetMaxContinuations 设置回答因max_tokens被截断时最多请求续写的次数，0表示不续写
+func (c *CodeChecker) SetMaxContinuations(n int) {
+	c.maxContinuations = n
+}
 
-	return chunks
+// SetRetryPolicy 设置响应内容无效时重新请求的等待时间和尝试次数，与API客户端使用同一策略
+func (c *CodeChecker) SetRetryPolicy(policy api.RetryPolicy) {
+	c.retryPolicy = policy
 }
 
-// 定义常量
-const noIssuesFound = "经过仔细审查，未发现任何问题。"
+// checkTask 定义检查任务结构
+type checkTask struct {
+	filePath    string
+	relPath     string // 相对于检查目录的路径
+	contentHash string // 规划任务时文件内容的哈希
+	rule        api.Rule
+}
+
+// checkResult 定义检查任务的执行结果
+type checkResult struct {
+	task     checkTask
+	result   formatter.Result
+	err      error
+	duration time.Duration
+}
+
+// errChunkSkipped 同一任务的其他分片已经失败，该分片不再调用API
+var errChunkSkipped = errors.New("skipped because another chunk of the same task failed")
+
+// errChunkNotDispatched 派发已停止，任务剩余的分片没有派发
+var errChunkNotDispatched = errors.New("not dispatched because checking was stopped")
+
+// chunkUnit 定义worker执行的最小单元：某个任务的一个分片
+type chunkUnit struct {
+	state *taskState
+	index int
+}
 
-// mergeResults 合并多个分片的检查结果
-func (c *CodeChecker) mergeResults(results []string) string {
+// taskState 记录一个任务各分片的执行情况
+// 除failed外只由结果处理循环修改，所有分片完成后按分片顺序合并结果
+type taskState struct {
+	task      checkTask
+	chunks    []codeChunk
+	outputs   []chunkOutput
+	remaining int         // 尚未返回结果的分片数
+	err       error       // 第一个失败分片的错误
+	failed    atomic.Bool // 有分片失败后，其余分片不再调用API
+	start     time.Time
+}
+
+// chunkOutput 单个分片的检查结果
+type chunkOutput struct {
+	text      string        // 模型返回的原始文本
+	findings  []api.Finding // 换算为文件行号后的问题列表
+	truncated bool          // 续写后回答仍被截断
+}
+
+// chunkResult 定义单个分片的执行结果，index为-1表示任务在分片前就失败了
+type chunkResult struct {
+	state  *taskState
+	index  int
+	output chunkOutput
+	err    error
+}
+
+// mergeResults 合并多个分片的检查结果，多个分片时标注每部分对应的行号范围
+func (c *CodeChecker) mergeResults(results []string, chunks []codeChunk) string {
 	if len(results) == 0 {
-		return noIssuesFound
+		return api.NoIssuesFound
 	}
 
 	// 合并所有结果
@@ -98,7 +199,7 @@ func (c *CodeChecker) mergeResults(results []string) string {
 
 	for i, result := range results {
 		if len(results) > 1 {
-			mergedResult.WriteString(fmt.Sprintf("## 第%d部分\n\n", i+1))
+			mergedResult.WriteString(fmt.Sprintf("## 第%d部分（第%d-%d行）\n\n", i+1, chunks[i].startLine, chunks[i].endLine))
 		}
 		mergedResult.WriteString(result)
 		mergedResult.WriteString("\n\n")
@@ -131,6 +232,11 @@ func (c *CodeChecker) matchKeywords(content string, rule api.Rule) bool {
 	return false
 }
 
+// ruleApplies 判断规则是否适用于文件，与规划任务时按后缀和关键字的过滤一致
+func (c *CodeChecker) ruleApplies(filePath, content string, rule api.Rule) bool {
+	return rule.Enabled && c.matchExtension(filePath, rule) && c.matchKeywords(content, rule)
+}
+
 // getApplicableRules 获取适用于文件的规则，needContent表示是否需要读取文件内容
 func (c *CodeChecker) getApplicableRules(filePath string) (rules []api.Rule, needContent bool) {
 	for _, rule := range c.rules {
@@ -163,156 +269,348 @@ func (c *CodeChecker) filterRulesByContent(rules []api.Rule, content string) []a
 	return filtered
 }
 
-// checkFileWithRule 检查单个文件的单个规则
-func (c *CodeChecker) checkFileWithRule(filePath string, rule api.Rule) ([]formatter.Result, error) {
-	// 读取文件内容
-	content, err := os.ReadFile(filePath)
+// checkChunk 对单个分片调用API进行检查，返回模型输出的原始文本
+// 回答因max_tokens被截断时会请求模型继续输出，续写次数用完后仍被截断时truncated为true
+func (c *CodeChecker) checkChunk(ctx context.Context, filePath string, chunk codeChunk, rule api.Rule) (result string, truncated bool, err error) {
+	// 构建请求数据
+	code := chunk.text(c.lineNumbers)
+	payload, err := c.apiClient.BuildPrompt(code, []api.Rule{rule}, c.apiModel, c.maxTokens)
 	if err != nil {
-		return nil, fmt.Errorf("read file failed: %v", err)
+		return "", false, fmt.Errorf("build prompt failed: %v", err)
 	}
 
-	// 将代码内容分片
-	chunks := c.splitCodeContent(string(content))
-	var chunkResults []string
+	result, finishReason, err := c.callAPI(ctx, filePath, rule, code, payload)
+	if err != nil {
+		return "", false, err
+	}
 
-	// 对每个分片进行检查
-	for i, chunk := range chunks {
-		// 构建请求数据
-		payload, err := c.apiClient.BuildPrompt(chunk, []api.Rule{rule}, c.apiModel, c.maxTokens)
+	// 回答被截断时，每轮都基于原始请求带上目前为止的全部输出请求模型继续，
+	// 不能在上一轮的续写请求上追加，否则之前的输出会重复出现在上下文中
+	for round := 0; finishReason == api.FinishReasonLength && round < c.maxContinuations; round++ {
+		next, err := c.apiClient.BuildContinuation(payload, result)
 		if err != nil {
-			return nil, fmt.Errorf("build prompt failed: %v", err)
+			fmt.Printf("警告: 无法构建续写请求: %s - %v\n", filePath, err)
+			break
 		}
-
-		// 调用API
-		responseData, err := c.apiClient.CallAPI(payload, c.apiURL, c.apiKey)
+		more, reason, err := c.callAPI(ctx, filePath, rule, code+result, next)
 		if err != nil {
-			return nil, fmt.Errorf("call API failed: %v", err)
+			return "", false, err
 		}
+		result += more
+		finishReason = reason
+	}
 
-		// 解析响应
-		result, err := c.apiClient.ParseResponse(responseData)
+	truncated = finishReason == api.FinishReasonLength
+	if truncated {
+		fmt.Printf("警告: AI回复因长度限制被截断，结果可能不完整: %s - %s（第%d-%d行）\n", filePath, rule.Name, chunk.startLine, chunk.endLine)
+	}
+	return result, truncated, nil
+}
+
+// callAPI 发送一次请求并解析响应，同时记录用量和统计信息
+// 响应内容为空或格式错误等可重试的情况按重试策略等待后重新请求，
+// 与CallAPI内部的重试共用重试策略的最大尝试次数，每次请求都计入统计和预算
+// prompt是请求中的主要文本，只在服务未返回usage时用于估算用量
+func (c *CodeChecker) callAPI(ctx context.Context, filePath string, rule api.Rule, prompt string, payload map[string]interface{}) (string, string, error) {
+	var (
+		responseData map[string]interface{}
+		callInfo     *api.CallInfo
+		result       string
+	)
+	maxAttempts := c.retryPolicy.Attempts()
+	sent := 0 // 已发送的请求数，包括CallAPI内部的重试
+	for attempt := 1; ; attempt++ {
+		// 调用API，请求失败的重试在CallAPI内部完成，最多使用剩余的尝试次数
+		var callCtx context.Context
+		callCtx, callInfo = api.WithCallInfo(ctx)
+		callInfo.MaxAttempts = maxAttempts - sent
+		var err error
+		responseData, err = c.apiClient.CallAPI(callCtx, payload, c.apiURL, c.apiKey)
+		sent += max(callInfo.Attempts, 1)
 		if err != nil {
-			return nil, fmt.Errorf("parse response failed: %v", err)
+			return "", "", fmt.Errorf("call API failed: %w", err)
 		}
 
-		chunkResults = append(chunkResults, result)
-
-		// 如果不是最后一个分片，等待一秒再继续
-		if i < len(chunks)-1 {
-			time.Sleep(time.Second)
+		// 解析响应，解析失败的请求同样计入统计和预算，结束原因记为错误类型
+		result, err = c.apiClient.ParseResponse(responseData)
+		if err == nil {
+			break
+		}
+		c.recordCall(filePath, rule, prompt, "", responseData, callInfo, api.ErrorKind(err))
+		if !api.IsRetryable(err) || sent >= maxAttempts || ctx.Err() != nil {
+			return "", "", fmt.Errorf("parse response failed: %w", err)
+		}
+		delay := c.retryPolicy.Delay(attempt)
+		fmt.Printf("警告: API响应无效 (第%d/%d次请求)，%v 后重新请求: %s - %v\n", sent, maxAttempts, delay.Round(time.Millisecond), filePath, err)
+		select {
+		case <-ctx.Done():
+			return "", "", fmt.Errorf("parse response failed: %w", err)
+		case <-time.After(delay):
 		}
 	}
+	finishReason := c.apiClient.ParseFinishReason(responseData)
+	c.recordCall(filePath, rule, prompt, result, responseData, callInfo, finishReason)
+	return result, finishReason, nil
+}
 
-	// 合并所有分片的结果
-	mergedResult := c.mergeResults(chunkResults)
+// recordCall 将一次请求的用量计入预算和统计，服务未返回usage时按估算值计入
+func (c *CodeChecker) recordCall(filePath string, rule api.Rule, prompt, result string, responseData map[string]interface{}, callInfo *api.CallInfo, finishReason string) {
+	usage := c.apiClient.ParseUsage(responseData)
+	estimated := usage.IsZero()
+	if estimated {
+		usage = c.estimateUsage(prompt, result, rule)
+	}
+	c.tracker.add(usage, estimated)
 
-	return []formatter.Result{{
-		File:         filePath,
-		Result:       mergedResult,
-		AppliedRules: []string{rule.Name},
-	}}, nil
+	model, _ := responseData["model"].(string)
+	if model == "" {
+		model = c.apiModel
+	}
+	c.stats.add(callRecord{
+		filePath:     filePath,
+		rule:         rule.Name,
+		model:        model,
+		usage:        usage,
+		estimated:    estimated,
+		latency:      callInfo.Latency,
+		attempts:     callInfo.Attempts,
+		finishReason: finishReason,
+	})
 }
 
-// CheckDirectory 检查目录
-func (c *CodeChecker) CheckDirectory(directory, outputDir string) error {
-	// 记录开始时间
-	startTime := time.Now()
-	fmt.Printf("开始检查，开始时间：%s (并发数: %d)\n", startTime.Format("2006-01-02 15:04:05"), c.concurrency)
+// estimateUsage 估算一次调用的用量
+func (c *CodeChecker) estimateUsage(code, result string, rule api.Rule) api.Usage {
+	prompt := api.PromptOverheadTokens(c.apiModel, []api.Rule{rule}, c.apiClient.StructuredOutput(), c.lineNumbers) + api.EstimateTokens(c.apiModel, code)
+	completion := api.EstimateTokens(c.apiModel, result)
+	return api.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
 
-	var files []string
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+// parseFindings 从模型输出中解析问题列表
+// 结构化输出解析失败时（如服务不支持JSON输出）退回到按Markdown格式解析
+func (c *CodeChecker) parseFindings(filePath, output string, chunk codeChunk) []api.Finding {
+	var findings []api.Finding
+	if c.apiClient.StructuredOutput() {
+		var err error
+		findings, err = api.ParseFindings(output)
 		if err != nil {
-			return err
+			fmt.Printf("警告: 解析结构化结果失败，按Markdown格式解析: %s - %v\n", filePath, err)
+			findings = api.ParseMarkdownFindings(output)
 		}
-		if !info.IsDir() {
-			files = append(files, path)
+	} else {
+		findings = api.ParseMarkdownFindings(output)
+	}
+
+	// 没有行号前缀时模型给出的是分片内的相对行号，换算为文件中的绝对行号
+	if !c.lineNumbers && (chunk.startLine > 1 || len(chunk.header) > 0) {
+		for i := range findings {
+			if findings[i].StartLine > 0 {
+				findings[i].StartLine, findings[i].EndLine = chunk.absoluteLine(findings[i].StartLine), chunk.absoluteLine(findings[i].EndLine)
+			}
 		}
-		return nil
-	})
+	}
+	return findings
+}
+
+// loadChunks 读取文件内容并分片
+func (c *CodeChecker) loadChunks(filePath string, rule api.Rule) ([]codeChunk, error) {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("walk directory failed: %v", err)
+		return nil, fmt.Errorf("read file failed: %v", err)
 	}
+	return c.splitCodeContent(filePath, string(content), rule), nil
+}
 
-	fmt.Printf("找到 %d 个文件需要检查\n", len(files))
+// checkChunkOutput 检查单个分片，并从模型输出中解析问题列表
+func (c *CodeChecker) checkChunkOutput(ctx context.Context, filePath string, chunk codeChunk, rule api.Rule) (chunkOutput, error) {
+	output, truncated, err := c.checkChunk(ctx, filePath, chunk, rule)
+	if err != nil {
+		return chunkOutput{}, err
+	}
+	return chunkOutput{text: output, findings: c.parseFindings(filePath, output, chunk), truncated: truncated}, nil
+}
 
-	enabledRules := 0
-	for _, rule := range c.rules {
-		if rule.Enabled {
-			enabledRules++
+// assembleResult 按分片顺序合并各分片的检查结果
+func (c *CodeChecker) assembleResult(filePath string, rule api.Rule, chunks []codeChunk, outputs []chunkOutput) formatter.Result {
+	var chunkResults []string
+	var findings []api.Finding
+	var truncated []formatter.LineRange
+	for i, out := range outputs {
+		// 分片有重叠时，重叠部分的问题可能被前后两个分片重复报告
+		chunkFindings := dedupeFindings(findings, out.findings)
+		findings = append(findings, chunkFindings...)
+
+		// 结构化输出时报告正文由问题列表渲染，保持与Markdown输出一致的格式
+		text := out.text
+		if c.apiClient.StructuredOutput() {
+			text = api.RenderFindingsMarkdown(chunkFindings)
+		}
+		if out.truncated {
+			text += "\n\n> ⚠️ AI回复因长度限制被截断，以上结果可能不完整"
+			truncated = append(truncated, formatter.LineRange{StartLine: chunks[i].startLine, EndLine: chunks[i].endLine})
 		}
+		chunkResults = append(chunkResults, text)
 	}
 
-	f := formatter.NewMarkdownFormatter(outputDir, c.svnLogLimit, c.svnPriorityAuthors)
+	// 合并所有分片的结果
+	mergedResult := c.mergeResults(chunkResults, chunks)
 
-	// 定义检查任务结构
-	type checkTask struct {
-		filePath string
-		rule     api.Rule
+	chunkRanges := make([]formatter.LineRange, 0, len(chunks))
+	for _, chunk := range chunks {
+		chunkRanges = append(chunkRanges, formatter.LineRange{StartLine: chunk.startLine, EndLine: chunk.endLine})
 	}
 
-	type checkResult struct {
-		task     checkTask
-		result   formatter.Result
-		err      error
-		duration time.Duration
+	return formatter.Result{
+		File:         filePath,
+		Result:       mergedResult,
+		AppliedRules: []string{rule.Name},
+		Findings:     findings,
+		Chunks:       chunkRanges,
+		Truncated:    truncated,
 	}
+}
 
-	// 创建任务列表
-	var tasks []checkTask
-	total := 0
-	skipped := 0
+// checkFileWithRule 依次检查单个文件各分片的单个规则
+func (c *CodeChecker) checkFileWithRule(ctx context.Context, filePath string, rule api.Rule) ([]formatter.Result, error) {
+	chunks, err := c.loadChunks(filePath, rule)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, filePath := range files {
-		// 先根据文件后缀获取可能适用的规则
-		applicableRules, needContent := c.getApplicableRules(filePath)
-		if len(applicableRules) == 0 {
-			total += enabledRules
-			fmt.Printf("跳过文件(后缀不匹配): %s\n", filePath)
-			continue
+	outputs := make([]chunkOutput, 0, len(chunks))
+	for _, chunk := range chunks {
+		output, err := c.checkChunkOutput(ctx, filePath, chunk, rule)
+		if err != nil {
+			return nil, err
 		}
+		outputs = append(outputs, output)
+	}
 
-		// 如果需要检查文件内容
-		if needContent {
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				return fmt.Errorf("read file failed: %v", err)
-			}
-			// 根据内容进一步过滤规则
-			applicableRules = c.filterRulesByContent(applicableRules, string(content))
-			if len(applicableRules) == 0 {
-				total += enabledRules
-				fmt.Printf("跳过文件(关键字不匹配): %s\n", filePath)
-				continue
-			}
-		}
+	return []formatter.Result{c.assembleResult(filePath, rule, chunks, outputs)}, nil
+}
 
-		// 检查SVN时间过滤
-		if c.svnFilterAfter != nil {
-			if !svn.HasCommitsAfterSafe(filePath, *c.svnFilterAfter) {
-				total += enabledRules
-				fmt.Printf("跳过文件(无最近提交): %s\n", filePath)
-				continue
-			}
+// collectChunk 记录一个分片的结果，任务的所有分片都返回后合并并返回该任务的结果
+func (c *CodeChecker) collectChunk(cr chunkResult) (checkResult, bool) {
+	state := cr.state
+	state.remaining--
+	if cr.err != nil {
+		// 保留真正的失败原因，而不是其他分片因此被跳过的错误
+		if state.err == nil || errors.Is(state.err, errChunkSkipped) || errors.Is(state.err, errChunkNotDispatched) {
+			state.err = cr.err
+		}
+	} else if cr.index >= 0 {
+		state.outputs[cr.index] = cr.output
+		if len(state.chunks) > 1 {
+			fmt.Printf("分片完成: %s - %s [第%d/%d部分]\n", state.task.filePath, state.task.rule.Name, cr.index+1, len(state.chunks))
 		}
+	}
+	if state.remaining > 0 {
+		return checkResult{}, false
+	}
 
-		// 为每个规则创建检查任务
-		for _, rule := range applicableRules {
-			if c.resultExists(filePath, rule.Name, outputDir) {
-				skipped++
-				total++
-				fmt.Printf("跳过已存在的检查结果: %s - %s\n", filePath, rule.Name)
-				continue
-			}
-			tasks = append(tasks, checkTask{filePath: filePath, rule: rule})
-			total++
+	result := checkResult{task: state.task, err: state.err, duration: time.Since(state.start)}
+	if state.err == nil {
+		result.result = c.assembleResult(state.task.filePath, state.task.rule, state.chunks, state.outputs)
+	}
+	return result, true
+}
+
+// dedupeFindings 去掉added中与existing标题和起始行都相同的问题
+func dedupeFindings(existing, added []api.Finding) []api.Finding {
+	if len(existing) == 0 {
+		return added
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, f := range existing {
+		seen[fmt.Sprintf("%d\x00%s", f.StartLine, f.Title)] = true
+	}
+	var kept []api.Finding
+	for _, f := range added {
+		if f.StartLine > 0 && seen[fmt.Sprintf("%d\x00%s", f.StartLine, f.Title)] {
+			continue
 		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// CheckDirectory 检查目录，ctx被取消或超时后停止派发新任务并尽快返回
+func (c *CodeChecker) CheckDirectory(ctx context.Context, directory, outputDir string) error {
+	// 记录开始时间
+	startTime := time.Now()
+	fmt.Printf("开始检查，开始时间：%s (并发数: %d)\n", startTime.Format("2006-01-02 15:04:05"), c.concurrency)
+	c.tracker = newBudgetTracker(c.budget, c.apiModel, startTime)
+	c.stats = &runStats{}
+
+	// 读取上次运行留下的失败清单和检查清单
+	previousFailures, err := loadFailures(outputDir)
+	if err != nil {
+		return err
+	}
+	manifest, err := loadManifest(outputDir)
+	if err != nil {
+		return err
+	}
+
+	formats := c.formats
+	if len(formats) == 0 {
+		formats = []string{"markdown"}
+	}
+	f, err := formatter.NewMulti(formats, formatter.Options{
+		OutputDir:          outputDir,
+		SourceDir:          directory,
+		Layout:             c.outputLayout,
+		SVNLogLimit:        c.svnLogLimit,
+		SVNPriorityAuthors: c.svnPriorityAuthors,
+		Rules:              c.rules,
+	})
+	if err != nil {
+		return fmt.Errorf("create formatter failed: %v", err)
 	}
 
+	// 规划任务
+	plan, err := c.planTasks(directory, previousFailures, manifest)
+	if err != nil {
+		return err
+	}
+	tasks := plan.tasks
+
 	fmt.Printf("实际需要检查的任务数: %d\n", len(tasks))
 
+	// ctx被取消后只停止派发新任务，进行中的任务使用独立的workCtx，
+	// 在宽限时间内允许其完成，超时后再取消
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	workDone := make(chan struct{})
+	defer close(workDone)
+	go func() {
+		select {
+		case <-workDone:
+			return
+		case <-ctx.Done():
+		}
+		if c.shutdownGrace <= 0 {
+			return
+		}
+		fmt.Printf("停止派发新任务，等待进行中的任务完成（最长 %v）\n", c.shutdownGrace)
+		timer := time.NewTimer(c.shutdownGrace)
+		defer timer.Stop()
+		select {
+		case <-workDone:
+		case <-timer.C:
+			fmt.Printf("等待超时，取消进行中的任务\n")
+			cancelWork()
+		}
+	}()
+
 	// 创建channel进行通信
-	taskChan := make(chan checkTask, len(tasks))
-	resultChan := make(chan checkResult, len(tasks))
+	// 大文件的各个分片作为独立的单元派发给worker，避免一个大文件长时间占用一个worker
+	// unitChan不带缓冲，保证取消后不会再有排队中的任务被执行
+	unitChan := make(chan chunkUnit)
+	resultChan := make(chan chunkResult, c.concurrency)
+
+	// 失败后停止时停止派发
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
 
 	// 启动goroutine池
 	var wg sync.WaitGroup
@@ -320,36 +618,71 @@ func (c *CodeChecker) CheckDirectory(directory, outputDir string) error {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			for task := range taskChan {
-				checkStartTime := time.Now()
-
-				// 执行单个文件的单个规则检查
-				results, err := c.checkFileWithRule(task.filePath, task.rule)
-				duration := time.Since(checkStartTime)
+			for unit := range unitChan {
+				state := unit.state
+				if state.failed.Load() {
+					resultChan <- chunkResult{state: state, index: unit.index, err: errChunkSkipped}
+					continue
+				}
 
+				// 执行单个分片的单个规则检查
+				output, err := c.checkChunkOutput(workCtx, state.task.filePath, state.chunks[unit.index], state.task.rule)
 				if err != nil {
-					resultChan <- checkResult{
-						task:     task,
-						err:      err,
-						duration: duration,
-					}
-				} else if len(results) > 0 {
-					resultChan <- checkResult{
-						task:     task,
-						result:   results[0], // 单个规则只会返回一个结果
-						duration: duration,
-					}
+					state.failed.Store(true)
 				}
+				resultChan <- chunkResult{state: state, index: unit.index, output: output, err: err}
 			}
 		}(i)
 	}
 
-	// 发送所有任务到channel
+	// 发送所有任务到channel，取消或达到预算上限后不再派发新任务；
+	// 已经开始的任务在派发停止后，剩余分片作为失败结果返回，保证每个任务都有结果
+	var dispatched int64
+	budgetReason := "" // 达到的预算上限，在close(unitChan)之前写入，结果处理完后读取
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
+		defer close(unitChan)
 		for _, task := range tasks {
-			taskChan <- task
+			if dispatchCtx.Err() != nil {
+				return
+			}
+			if reason := c.tracker.exceeded(); reason != "" {
+				budgetReason = reason
+				fmt.Printf("已达到预算上限（%s），停止派发新任务\n", reason)
+				return
+			}
+
+			state := &taskState{task: task, start: time.Now()}
+			chunks, err := c.loadChunks(task.filePath, task.rule)
+			if err != nil {
+				atomic.AddInt64(&dispatched, 1)
+				state.remaining = 1
+				resultChan <- chunkResult{state: state, index: -1, err: err}
+				continue
+			}
+			state.chunks = chunks
+			state.outputs = make([]chunkOutput, len(chunks))
+			state.remaining = len(chunks)
+
+			select {
+			case <-dispatchCtx.Done():
+				return
+			case unitChan <- chunkUnit{state: state, index: 0}:
+				atomic.AddInt64(&dispatched, 1)
+			}
+			for i := 1; i < len(chunks); i++ {
+				select {
+				case <-dispatchCtx.Done():
+					state.failed.Store(true)
+					for ; i < len(chunks); i++ {
+						resultChan <- chunkResult{state: state, index: i, err: errChunkNotDispatched}
+					}
+					return
+				case unitChan <- chunkUnit{state: state, index: i}:
+				}
+			}
 		}
-		close(taskChan)
 	}()
 
 	// 收集结果
@@ -358,32 +691,158 @@ func (c *CodeChecker) CheckDirectory(directory, outputDir string) error {
 		close(resultChan)
 	}()
 
-	// 处理结果
+	// 处理结果，所有退出都经过循环结束后的同一路径：
+	// 出错时只停止派发并取消进行中的分片，继续读取resultChan直到worker和派发goroutine全部退出，
+	// 之后再保存失败清单和统计，避免goroutine阻塞在resultChan上或与统计写入并发
+	var abortErr error
 	completed := 0
 	checkedFiles := make(map[string]bool) // 用于跟踪已检查的唯一文件
-	for result := range resultChan {
+	succeeded := make(map[string]bool)    // 本次成功完成的任务
+	reported := make(map[string]bool)     // 本次已输出结果的任务，按相对路径记录
+	authors := make(map[string]string)    // 文件的主要作者，同一文件的多条规则只查询一次svn
+	var failures []FailedTask
+	for cr := range resultChan {
+		if abortErr != nil {
+			continue
+		}
+		result, done := c.collectChunk(cr)
+		if !done {
+			continue
+		}
 		completed++
 		totalDuration := time.Since(startTime)
 
 		if result.err != nil {
-			return fmt.Errorf("检查文件 %s 规则 %s 失败: %v", result.task.filePath, result.task.rule.Name, result.err)
+			failures = append(failures, FailedTask{
+				File:  result.task.filePath,
+				Rule:  result.task.rule.Name,
+				Error: result.err.Error(),
+				Kind:  api.ErrorKind(result.err),
+				Time:  time.Now().Format("2006-01-02 15:04:05"),
+			})
+
+			if ctx.Err() != nil {
+				continue
+			}
+			if !c.continueOnError {
+				// 停止派发并取消进行中的分片，剩余结果丢弃
+				abortErr = fmt.Errorf("检查文件 %s 规则 %s 失败: %v", result.task.filePath, result.task.rule.Name, result.err)
+				stopDispatch()
+				cancelWork()
+				continue
+			}
+
+			fmt.Printf("进度: %d/%d - 检查失败: %s - %s [错误: %v]\n",
+				completed, len(tasks), result.task.filePath, result.task.rule.Name, result.err)
+			continue
+		}
+
+		// 作者随结果保存到检查清单，之后恢复该结果时不再查询svn
+		author, ok := authors[result.task.filePath]
+		if !ok {
+			author = svn.GetFileAuthorSafe(result.task.filePath, c.svnLogLimit, c.svnPriorityAuthors)
+			authors[result.task.filePath] = author
 		}
+		result.result.Author = author
+		// 报告和检查清单使用同一检查时间，按新布局重新生成的报告与原报告一致
+		result.result.CheckedAt = time.Now().Format("2006-01-02 15:04:05")
 
 		// 添加结果到formatter
 		if err := f.AddResult(result.result); err != nil {
-			return fmt.Errorf("add result failed: %v", err)
+			// 结果没有写入报告，记入失败清单以便重新检查
+			failures = append(failures, FailedTask{
+				File:  result.task.filePath,
+				Rule:  result.task.rule.Name,
+				Error: err.Error(),
+				Time:  time.Now().Format("2006-01-02 15:04:05"),
+			})
+			abortErr = fmt.Errorf("add result failed: %v", err)
+			stopDispatch()
+			cancelWork()
+			continue
 		}
 
 		// 记录已检查的文件
 		checkedFiles[result.task.filePath] = true
+		succeeded[failureKey(result.task.filePath, result.task.rule.Name)] = true
+		reported[failureKey(result.task.relPath, result.task.rule.Name)] = true
+
+		// 更新检查清单，每完成一个任务保存一次，中断后也能从断点继续
+		if err := manifest.record(result.task.rule.Name, result.task.relPath, result.task.contentHash, hashRule(result.task.rule), c.apiModel, c.outputLayout, result.result); err != nil {
+			fmt.Printf("警告: 保存检查结果失败，该任务不会出现在之后的汇总报告中: %v\n", err)
+		}
+		if err := manifest.save(); err != nil {
+			fmt.Printf("警告: 保存检查清单失败: %v\n", err)
+		}
 
 		fmt.Printf("进度: %d/%d - 检查完成: %s - %s [单次耗时: %v, 总耗时: %v, 已检查文件: %d]\n",
 			completed, len(tasks), result.task.filePath, result.task.rule.Name,
 			result.duration.Round(time.Millisecond), totalDuration.Round(time.Second), len(checkedFiles))
 	}
 
+	// 汇总报告还要包含本次跳过的、检查结果仍然有效的任务，否则只会包含本次运行的结果
+	if restorer, ok := f.(formatter.Restorer); ok {
+		previous, missing := manifest.previousResults(directory, c.rules, c.apiModel, reported, c.ruleApplies)
+		relaid := 0 // 按新布局重新生成报告的条目数
+		for _, p := range previous {
+			if err := restorer.RestoreResult(p.result); err != nil {
+				if abortErr == nil {
+					abortErr = fmt.Errorf("restore result failed: %v", err)
+				}
+				continue
+			}
+			if p.result.Layout != c.outputLayout {
+				manifest.setLayout(p.rule, p.relPath, c.outputLayout)
+				relaid++
+			}
+		}
+		if relaid > 0 {
+			fmt.Printf("输出布局已变化，按新布局重新生成了 %d 个跳过任务的报告\n", relaid)
+			if err := manifest.save(); err != nil {
+				fmt.Printf("警告: 保存检查清单失败: %v\n", err)
+			}
+		}
+		if missing > 0 {
+			fmt.Printf("提示: %d 个跳过的任务没有保存的检查结果（由旧版本检查或保存失败），不会出现在汇总报告中；删除 %s 可全部重新检查\n",
+				missing, filepath.Join(outputDir, manifestFileName))
+		}
+	}
+
 	if err := f.Close(); err != nil {
-		return fmt.Errorf("close formatter failed: %v", err)
+		if abortErr != nil {
+			fmt.Printf("警告: 关闭格式化器失败: %v\n", err)
+		} else {
+			abortErr = fmt.Errorf("close formatter failed: %v", err)
+		}
+	}
+
+	// 达到预算上限时，未派发的任务记入失败清单，下次可用 -retry-failed 继续
+	notDispatched := tasks[atomic.LoadInt64(&dispatched):]
+	if budgetReason != "" && ctx.Err() == nil {
+		for _, task := range notDispatched {
+			failures = append(failures, FailedTask{
+				File:  task.filePath,
+				Rule:  task.rule.Name,
+				Error: "未处理: " + budgetReason,
+				Time:  time.Now().Format("2006-01-02 15:04:05"),
+			})
+		}
+	}
+
+	c.saveFailures(outputDir, previousFailures, failures, succeeded)
+	c.writeStats(outputDir, time.Since(startTime))
+	fmt.Printf("本次%s\n", c.tracker.summary())
+
+	if abortErr != nil {
+		return abortErr
+	}
+
+	if ctx.Err() != nil {
+		// 打印续检摘要，下次运行会跳过已完成的任务
+		fmt.Printf("检查已中断：本次完成 %d 个任务，中断或失败 %d 个任务，未开始 %d 个任务\n",
+			len(succeeded), len(failures), len(notDispatched))
+		fmt.Printf("已完成的结果已保存到 %s，再次运行将跳过已完成的任务继续检查\n", outputDir)
+		return fmt.Errorf("检查已取消: %v", ctx.Err())
 	}
 
 	// 计算总耗时
@@ -391,39 +850,70 @@ func (c *CodeChecker) CheckDirectory(directory, outputDir string) error {
 	endTime := time.Now()
 
 	fmt.Printf("检查完成，报告已生成到目录: %s\n", outputDir)
-	fmt.Printf("总计跳过 %d 个已存在的检查结果\n", skipped)
+	fmt.Printf("总计跳过 %d 个未变化的检查任务\n", plan.skipped)
 	fmt.Printf("总耗时: %v (开始时间: %s, 结束时间: %s)\n",
 		totalDuration.Round(time.Second),
 		startTime.Format("2006-01-02 15:04:05"),
 		endTime.Format("2006-01-02 15:04:05"))
+
+	if budgetReason != "" {
+		return fmt.Errorf("已达到预算上限（%s），%d 个任务未处理，已记录到 %s，可使用 -retry-failed 继续",
+			budgetReason, len(notDispatched), filepath.Join(outputDir, failuresFileName))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d 个检查任务失败，详见 %s，可使用 -retry-failed 重新执行",
+			len(failures), filepath.Join(outputDir, failuresFileName))
+	}
 	return nil
 }
 
-// resultExists 检查结果文件是否已存在（检查带作者前缀的文件）
-func (c *CodeChecker) resultExists(filePath, ruleName, outputDir string) bool {
-	// 只替换Windows不允许的特殊字符: < > : " / \ | ? *
-	// 保留中文等其他字符
-	ruleDirname := regexp.MustCompile(`[<>:"/\\|?*]`).ReplaceAllString(ruleName, "_")
-	ruleDir := filepath.Join(outputDir, ruleDirname)
+// saveFailures 合并并保存失败任务清单，保存失败时只打印警告
+func (c *CodeChecker) saveFailures(outputDir string, previous, current []FailedTask, succeeded map[string]bool) {
+	merged := mergeFailures(previous, current, succeeded)
+	if err := saveFailures(outputDir, merged); err != nil {
+		fmt.Printf("警告: 保存失败任务清单失败: %v\n", err)
+		return
+	}
+	if len(merged) > 0 {
+		fmt.Printf("失败任务清单已更新: %s (共 %d 个任务)\n", filepath.Join(outputDir, failuresFileName), len(merged))
+	}
+}
 
-	fileName := filepath.Base(filePath)
-	// 生成基础安全文件名（不带作者前缀）
-	safeFileName := regexp.MustCompile(`[<>:"/\\|?*]`).ReplaceAllString(fileName, "_")
+// planRetryTasks 根据失败清单生成重试任务
+func (c *CodeChecker) planRetryTasks(directory string, failures []FailedTask) []checkTask {
+	rulesByName := make(map[string]api.Rule)
+	for _, rule := range c.rules {
+		if rule.Enabled {
+			rulesByName[rule.Name] = rule
+		}
+	}
 
-	// 检查是否存在任何以这个基础文件名结尾的文件
-	// 这样可以匹配带作者前缀的文件，如 [author]filename.lua.md
-	pattern := filepath.Join(ruleDir, "*"+safeFileName+".md")
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return false
+	var tasks []checkTask
+	for _, failure := range failures {
+		rule, ok := rulesByName[failure.Rule]
+		if !ok {
+			fmt.Printf("跳过失败任务(规则不存在或未启用): %s - %s\n", failure.File, failure.Rule)
+			continue
+		}
+		content, err := os.ReadFile(failure.File)
+		if err != nil {
+			fmt.Printf("跳过失败任务(文件无法读取): %s - %s\n", failure.File, failure.Rule)
+			continue
+		}
+		tasks = append(tasks, checkTask{
+			filePath:    failure.File,
+			relPath:     relativePath(directory, failure.File),
+			contentHash: hashContent(content),
+			rule:        rule,
+		})
 	}
 
-	// 如果找到匹配的文件，说明结果已存在
-	return len(matches) > 0
+	fmt.Printf("从失败清单中加载 %d 个任务需要重试\n", len(tasks))
+	return tasks
 }
 
 // CheckFile 检查单个文件
-func (c *CodeChecker) CheckFile(filePath string) ([]formatter.Result, error) {
+func (c *CodeChecker) CheckFile(ctx context.Context, filePath string) ([]formatter.Result, error) {
 	// 先根据文件后缀获取可能适用的规则
 	applicableRules, needContent := c.getApplicableRules(filePath)
 	if len(applicableRules) == 0 {
@@ -454,46 +944,11 @@ func (c *CodeChecker) CheckFile(filePath string) ([]formatter.Result, error) {
 
 	var results []formatter.Result
 	for _, rule := range applicableRules {
-		// 将代码内容分片
-		chunks := c.splitCodeContent(string(content))
-		var chunkResults []string
-
-		// 对每个分片进行检查
-		for i, chunk := range chunks {
-			// 构建请求数据
-			payload, err := c.apiClient.BuildPrompt(chunk, []api.Rule{rule}, c.apiModel, c.maxTokens)
-			if err != nil {
-				return nil, fmt.Errorf("build prompt failed: %v", err)
-			}
-
-			// 调用API
-			responseData, err := c.apiClient.CallAPI(payload, c.apiURL, c.apiKey)
-			if err != nil {
-				return nil, fmt.Errorf("call API failed: %v", err)
-			}
-
-			// 解析响应
-			result, err := c.apiClient.ParseResponse(responseData)
-			if err != nil {
-				return nil, fmt.Errorf("parse response failed: %v", err)
-			}
-
-			chunkResults = append(chunkResults, result)
-
-			// 如果不是最后一个分片，等待一秒再继续
-			if i < len(chunks)-1 {
-				time.Sleep(time.Second)
-			}
+		ruleResults, err := c.checkFileWithRule(ctx, filePath, rule)
+		if err != nil {
+			return nil, err
 		}
-
-		// 合并所有分片的结果
-		mergedResult := c.mergeResults(chunkResults)
-
-		results = append(results, formatter.Result{
-			File:         filePath,
-			Result:       mergedResult,
-			AppliedRules: []string{rule.Name},
-		})
+		results = append(results, ruleResults...)
 	}
 
 	return results, nil
@@ -0,0 +1,268 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+)
+
+// messageList 把请求中的messages简化为 "角色:内容" 列表
+func messageList(t *testing.T, payload map[string]interface{}) []string {
+	t.Helper()
+	messages, ok := payload["messages"].([]map[string]interface{})
+	if !ok {
+		t.Fatalf("payload has no messages: %v", payload)
+	}
+	var list []string
+	for _, m := range messages {
+		list = append(list, fmt.Sprintf("%s:%v", m["role"], m["content"]))
+	}
+	return list
+}
+
+func TestCheckChunkContinuationOpenAI(t *testing.T) {
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	client.respond = func(call int) map[string]interface{} {
+		reason := "length"
+		if call == 3 {
+			reason = "stop"
+		}
+		return map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{
+				"message":       map[string]interface{}{"role": "assistant", "content": fmt.Sprintf("P%d ", call)},
+				"finish_reason": reason,
+			}},
+		}
+	}
+	c, _ := NewCodeChecker(nil, "", "", "m", 0, 100, 0, 1, nil, nil, client)
+	c.SetMaxContinuations(3)
+
+	result, truncated, err := c.checkChunk(context.Background(), "a.go", codeChunk{content: "x", startLine: 1, endLine: 1}, api.Rule{Name: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "P1 P2 P3 " || truncated {
+		t.Fatalf("result = %q, truncated = %v", result, truncated)
+	}
+	if len(client.payloads) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(client.payloads))
+	}
+
+	original := messageList(t, client.payloads[0])
+	for round, want := range [][]string{
+		append(append([]string{}, original...), "assistant:P1 ", "user:"+continuationText(t, client.payloads[1])),
+		append(append([]string{}, original...), "assistant:P1 P2 ", "user:"+continuationText(t, client.payloads[2])),
+	} {
+		got := messageList(t, client.payloads[round+1])
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round %d messages =\n%q\nwant\n%q", round+1, got, want)
+		}
+	}
+}
+
+func TestCheckChunkContinuationAnthropic(t *testing.T) {
+	client := &fakeClient{AIClient: api.NewAnthropicClient()}
+	client.respond = func(call int) map[string]interface{} {
+		reason := "max_tokens"
+		if call == 3 {
+			reason = "end_turn"
+		}
+		return map[string]interface{}{
+			"content":     []interface{}{map[string]interface{}{"type": "text", "text": fmt.Sprintf("P%d ", call)}},
+			"stop_reason": reason,
+		}
+	}
+	c, _ := NewCodeChecker(nil, "", "", "m", 0, 100, 0, 1, nil, nil, client)
+	c.SetMaxContinuations(3)
+
+	result, truncated, err := c.checkChunk(context.Background(), "a.go", codeChunk{content: "x", startLine: 1, endLine: 1}, api.Rule{Name: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "P1 P2 P3 " || truncated {
+		t.Fatalf("result = %q, truncated = %v", result, truncated)
+	}
+
+	// 每轮只有原始的user消息和一条包含全部已输出内容的assistant预填充
+	for round, prefill := range []string{"P1", "P1 P2"} {
+		messages := client.payloads[round+1]["messages"].([]map[string]interface{})
+		if len(messages) != 2 || messages[0]["role"] != "user" || messages[1]["role"] != "assistant" || messages[1]["content"] != prefill {
+			t.Errorf("round %d messages = %v, want user + assistant %q", round+1, messages, prefill)
+		}
+	}
+}
+
+func TestCheckChunkStillTruncated(t *testing.T) {
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	client.respond = func(call int) map[string]interface{} {
+		return map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{
+				"message":       map[string]interface{}{"role": "assistant", "content": "P"},
+				"finish_reason": "length",
+			}},
+		}
+	}
+	c, _ := NewCodeChecker(nil, "", "", "m", 0, 100, 0, 1, nil, nil, client)
+	c.SetMaxContinuations(2)
+
+	result, truncated, err := c.checkChunk(context.Background(), "a.go", codeChunk{content: "x", startLine: 1, endLine: 1}, api.Rule{Name: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "PPP" || !truncated || len(client.payloads) != 3 {
+		t.Fatalf("result = %q, truncated = %v, requests = %d", result, truncated, len(client.payloads))
+	}
+}
+
+// continuationText 返回续写请求最后一条user消息的内容
+func continuationText(t *testing.T, payload map[string]interface{}) string {
+	t.Helper()
+	messages := payload["messages"].([]map[string]interface{})
+	return fmt.Sprint(messages[len(messages)-1]["content"])
+}
+
+// newDirectoryChecker 创建有20个多分片文件的源目录，返回使用client检查该目录的CodeChecker
+func newDirectoryChecker(t *testing.T, client *fakeClient) (*CodeChecker, string) {
+	t.Helper()
+	src := t.TempDir()
+	for i := 0; i < 20; i++ {
+		var code strings.Builder
+		for line := 0; line < 40; line++ {
+			fmt.Fprintf(&code, "func f%d() { return %d }\n", line, line)
+		}
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprintf("f%02d.go", i)), []byte(code.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client.respond = func(call int) map[string]interface{} {
+		time.Sleep(time.Millisecond)
+		return map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{
+				"message":       map[string]interface{}{"role": "assistant", "content": "发现问题"},
+				"finish_reason": "stop",
+			}},
+		}
+	}
+	rules := []api.Rule{{Name: "r", Extensions: []string{".go"}, Enabled: true}}
+	c, err := NewCodeChecker(rules, "", "", "m", 0, 100, 0, 4, nil, nil, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxChunkTokens(100) // 每个文件拆成多个分片
+	return c, src
+}
+
+// checkDirectoryStopped 检查目录，要求在出错后及时返回，并且仍然保存失败清单和统计
+func checkDirectoryStopped(t *testing.T, c *CodeChecker, src, out, wantErr string) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- c.CheckDirectory(context.Background(), src, out) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("CheckDirectory did not return after a failure")
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("err = %v, want %q", err, wantErr)
+	}
+	for _, name := range []string{failuresFileName, statsJSONFileName} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+}
+
+func TestCheckDirectoryFailFast(t *testing.T) {
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	client.fail = func(call int) error {
+		if call == 5 {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	c, src := newDirectoryChecker(t, client)
+	checkDirectoryStopped(t, c, src, t.TempDir(), "boom")
+}
+
+func TestCheckDirectoryAddResultError(t *testing.T) {
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	c, src := newDirectoryChecker(t, client)
+	c.SetContinueOnError(true)
+
+	// 规则目录的位置是一个普通文件，写入Markdown结果失败
+	out := t.TempDir()
+	if err := os.WriteFile(filepath.Join(out, "r"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkDirectoryStopped(t, c, src, out, "add result failed")
+}
+
+func TestCallAPIRetriesInvalidResponse(t *testing.T) {
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	client.respond = func(call int) map[string]interface{} {
+		if call < 3 {
+			return map[string]interface{}{"choices": []interface{}{}}
+		}
+		return map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{
+				"message":       map[string]interface{}{"role": "assistant", "content": "ok"},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]interface{}{"prompt_tokens": 10.0, "completion_tokens": 2.0, "total_tokens": 12.0},
+		}
+	}
+	c, _ := NewCodeChecker(nil, "", "", "m", 0, 100, 0, 1, nil, nil, client)
+	c.SetRetryPolicy(api.RetryPolicy{BaseDelayMs: 50, MaxDelayMs: 1000})
+	c.tracker = newBudgetTracker(Budget{}, "m", time.Now())
+	c.stats = &runStats{}
+
+	start := time.Now()
+	result, reason, err := c.callAPI(context.Background(), "a.go", api.Rule{Name: "r"}, "x", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "ok" || reason != "stop" {
+		t.Fatalf("result = %q, reason = %q", result, reason)
+	}
+	// 两次无效响应后分别等待约50ms和100ms（抖动不超过20%）
+	if elapsed := time.Since(start); elapsed < 120*time.Millisecond {
+		t.Errorf("retried after %v, want backoff between attempts", elapsed)
+	}
+
+	stats := c.stats.build(time.Second, 0, nil)
+	if stats.Total.Calls != 3 || stats.Total.FinishReasons["empty_choices"] != 2 || stats.Total.FinishReasons["stop"] != 1 {
+		t.Errorf("stats = %d calls, finish reasons %v, want every attempt recorded", stats.Total.Calls, stats.Total.FinishReasons)
+	}
+	if stats.Total.EstimatedCalls != 2 {
+		t.Errorf("estimated calls = %d, want the invalid responses estimated", stats.Total.EstimatedCalls)
+	}
+}
+
+func TestCallAPIInvalidResponseAttempts(t *testing.T) {
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	client.respond = func(call int) map[string]interface{} {
+		return map[string]interface{}{"choices": []interface{}{}}
+	}
+	c, _ := NewCodeChecker(nil, "", "", "m", 0, 100, 0, 1, nil, nil, client)
+	c.SetRetryPolicy(api.RetryPolicy{MaxAttempts: 2, BaseDelayMs: 1, MaxDelayMs: 1})
+	c.tracker = newBudgetTracker(Budget{}, "m", time.Now())
+	c.stats = &runStats{}
+
+	// 响应无效的重新请求计入重试策略的最大尝试次数
+	if _, _, err := c.callAPI(context.Background(), "a.go", api.Rule{Name: "r"}, "x", map[string]interface{}{}); err == nil {
+		t.Fatal("want the invalid response error")
+	}
+	if len(client.payloads) != 2 {
+		t.Errorf("sent %d requests, want max_attempts 2", len(client.payloads))
+	}
+}
@@ -0,0 +1,586 @@
+package checker
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zx2/code-checker/pkg/api"
+)
+
+// 分片策略
+const (
+	ChunkStrategySyntax = "syntax" // 优先在顶层函数/类边界处分片，无法识别时退回按行分片
+	ChunkStrategyLine   = "line"   // 只按行分片
+)
+
+// codeChunk 定义发送给API的一个代码分片
+type codeChunk struct {
+	content   string       // 分片的原始代码
+	startLine int          // 分片第一行在文件中的行号，从1开始
+	endLine   int          // 分片最后一行在文件中的行号
+	header    []headerLine // 分片起点所在的外层函数/类的签名，作为上下文放在代码前面
+}
+
+// headerLine 定义上下文头部中的一行
+type headerLine struct {
+	line int    // 行号
+	text string // 原始代码
+}
+
+// chunker 负责将文件内容切分为适合单次请求的分片
+type chunker struct {
+	limit         int              // 单个分片的最大长度（字节数或token数，取决于measure）
+	measure       func(string) int // 计算文本长度的方法
+	strategy      string           // 分片策略
+	overlap       int              // 相邻分片之间重叠的行数
+	contextHeader bool             // 是否在分片前加上外层函数/类的签名
+}
+
+// 分片大小的默认值
+const (
+	DefaultMaxTextLength = 4000 // 模型不在内置目录中且未配置分片大小时，按字节数分片的上限
+	minChunkTokens       = 512  // 自动计算出的分片token数下限
+	lineNumberTokens     = 2    // 每行行号前缀大约占用的token数
+)
+
+// splitCodeContent 将代码内容分片，并记录每个分片的起止行号
+func (c *CodeChecker) splitCodeContent(filePath, content string, rule api.Rule) []codeChunk {
+	limit, measure := c.chunkLimit(rule)
+	ch := chunker{
+		limit:         limit,
+		measure:       measure,
+		strategy:      c.chunkStrategy,
+		overlap:       c.chunkOverlap,
+		contextHeader: c.chunkContextHeader,
+	}
+	return ch.split(filePath, content)
+}
+
+// chunkLimit 返回单个分片的长度上限和计算每行长度的方法
+// 优先级：api.max_chunk_tokens > api.max_text_length（字节数）> 按模型上下文窗口自动计算
+func (c *CodeChecker) chunkLimit(rule api.Rule) (int, func(string) int) {
+	byteLength := func(s string) int { return len(s) }
+
+	count := api.TokenCounter(c.apiModel)
+	tokenLength := count
+	if c.lineNumbers {
+		tokenLength = func(s string) int { return count(s) + lineNumberTokens }
+	}
+
+	if c.maxChunkTokens > 0 {
+		return c.maxChunkTokens, tokenLength
+	}
+	if c.maxTextLength > 0 {
+		return c.maxTextLength, byteLength
+	}
+
+	// 配置的上下文窗口优先于内置模型目录
+	contextWindow := c.contextWindow
+	if contextWindow <= 0 {
+		if info, ok := api.LookupModel(c.apiModel); ok {
+			contextWindow = info.ContextWindow
+		}
+	}
+	if contextWindow <= 0 {
+		return DefaultMaxTextLength, byteLength
+	}
+
+	// 上下文窗口需要同时容纳提示词、代码和模型的输出，再留出10%的估算误差
+	overhead := api.PromptOverheadTokens(c.apiModel, []api.Rule{rule}, c.apiClient.StructuredOutput(), c.lineNumbers)
+	limit := (contextWindow - c.maxTokens - overhead) * 9 / 10
+	if limit < minChunkTokens {
+		limit = minChunkTokens
+	}
+	return limit, tokenLength
+}
+
+// split 执行分片
+func (ch *chunker) split(filePath, content string) []codeChunk {
+	lines := strings.Split(content, "\n")
+	total := -1 // 换行符只在行与行之间
+	for _, line := range lines {
+		total += ch.measure(line) + 1
+	}
+	if total <= ch.limit {
+		return []codeChunk{{content: content, startLine: 1, endLine: len(lines)}}
+	}
+
+	// 按语法分片时先分析每行所处的代码块
+	var infos []lineInfo
+	if ch.strategy != ChunkStrategyLine {
+		if lang := languageOf(filePath); lang != "" {
+			infos = analyzeLines(lang, lines)
+		}
+	}
+
+	var chunks []codeChunk
+	start := 0
+	size := 0
+
+	for i := 0; i < len(lines); {
+		lineSize := ch.measure(lines[i]) + 1
+
+		// 如果当前分片加上新行会超过最大长度，就开始新的分片
+		if size+lineSize > ch.limit && i > start {
+			cut := i
+			if b := findBoundary(infos, lines, start, i); b > start {
+				cut = b
+			}
+			chunks = append(chunks, ch.newChunk(lines, infos, start, cut))
+			start = cut
+			size = 0
+			for _, line := range lines[start:i] {
+				size += ch.measure(line) + 1
+			}
+			continue
+		}
+
+		size += lineSize
+		i++
+	}
+
+	// 添加最后一个分片
+	if start < len(lines) {
+		chunks = append(chunks, ch.newChunk(lines, infos, start, len(lines)))
+	}
+
+	return chunks
+}
+
+// newChunk 用lines[start:end]创建分片，并按配置加上重叠行和上下文头部
+func (ch *chunker) newChunk(lines []string, infos []lineInfo, start, end int) codeChunk {
+	from := start
+	if ch.overlap > 0 {
+		from = start - ch.overlap
+		if from < 0 {
+			from = 0
+		}
+	}
+
+	chunk := codeChunk{
+		content:   strings.Join(lines[from:end], "\n"),
+		startLine: from + 1,
+		endLine:   end,
+	}
+
+	if ch.contextHeader && infos != nil && from > 0 {
+		for _, idx := range infos[from].openers {
+			chunk.header = append(chunk.header, headerLine{line: idx + 1, text: lines[idx]})
+		}
+	}
+	return chunk
+}
+
+// findBoundary 在(start, end]范围内从后向前查找可以作为新分片起点的行
+// 找到后会继续向上包含紧邻的注释行，避免把函数和它的注释拆开；找不到时返回-1
+func findBoundary(infos []lineInfo, lines []string, start, end int) int {
+	if infos == nil {
+		return -1
+	}
+	for j := end; j > start; j-- {
+		if !infos[j].safe {
+			continue
+		}
+		for j-1 > start && infos[j-1].comment {
+			j--
+		}
+		return j
+	}
+	return -1
+}
+
+// text 返回发送给API的分片文本
+// 有上下文头部时先列出外层签名，再用 "..." 表示省略的代码
+func (chunk codeChunk) text(lineNumbers bool) string {
+	width := len(strconv.Itoa(chunk.endLine))
+	var b strings.Builder
+	for _, h := range chunk.header {
+		if lineNumbers {
+			b.WriteString(fmt.Sprintf("%*d| %s\n", width, h.line, h.text))
+		} else {
+			b.WriteString(h.text + "\n")
+		}
+	}
+	if len(chunk.header) > 0 {
+		if lineNumbers {
+			b.WriteString(fmt.Sprintf("%*s| ...\n", width, ""))
+		} else {
+			b.WriteString("...\n")
+		}
+	}
+
+	if !lineNumbers {
+		b.WriteString(chunk.content)
+		return b.String()
+	}
+	for i, line := range strings.Split(chunk.content, "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(fmt.Sprintf("%*d| %s", width, chunk.startLine+i, line))
+	}
+	return b.String()
+}
+
+// absoluteLine 将不带行号时模型给出的分片内行号换算为文件中的行号
+func (chunk codeChunk) absoluteLine(relative int) int {
+	if relative <= 0 {
+		return 0
+	}
+	if len(chunk.header) > 0 {
+		// 头部签名行加上一行 "..."
+		relative -= len(chunk.header) + 1
+		if relative <= 0 {
+			return 0
+		}
+	}
+	return chunk.startLine + relative - 1
+}
+
+// languageOf 根据文件后缀判断分片使用的语言规则，不支持的语言返回空字符串
+func languageOf(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".lua":
+		return "lua"
+	case ".py":
+		return "python"
+	case ".go":
+		return "go"
+	case ".c":
+		return "c"
+	case ".h", ".hh", ".hpp", ".hxx", ".cc", ".cpp", ".cxx":
+		return "cpp"
+	case ".java":
+		return "java"
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx":
+		return "js"
+	}
+	return ""
+}
+
+// lineInfo 记录每行开始处的语法状态
+type lineInfo struct {
+	safe    bool  // 该行位于顶层（或只在类、命名空间等容器内），可以作为分片起点
+	comment bool  // 该行是单独的注释或注解行，分片时与下面的函数放在一起
+	openers []int // 该行开始时仍未结束的外层代码块的起始行下标，由外到内
+}
+
+// containerPatterns 各语言中可以在内部分片的容器代码块（类、命名空间等）
+var containerPatterns = map[string]*regexp.Regexp{
+	"c":    regexp.MustCompile(`extern\s+"C"`),
+	"cpp":  regexp.MustCompile(`\b(class|struct|namespace)\b|extern\s+"C"`),
+	"java": regexp.MustCompile(`\b(class|interface|enum|record)\b`),
+	"js":   regexp.MustCompile(`\bclass\b`),
+}
+
+// analyzeLines 分析每行所处的代码块
+func analyzeLines(lang string, lines []string) []lineInfo {
+	switch lang {
+	case "lua":
+		return analyzeLua(lines)
+	case "python":
+		return analyzePython(lines)
+	default:
+		return analyzeBraces(containerPatterns[lang], lines)
+	}
+}
+
+// braceBlock 花括号语言中的一个代码块
+type braceBlock struct {
+	line      int  // 代码块签名所在的行
+	container bool // 是否为类、命名空间等容器
+}
+
+// analyzeBraces 分析C/C++、Java、JavaScript、Go等使用花括号的语言
+// 只在所有未结束的代码块都是容器时允许分片，因此不会把函数体拆开
+func analyzeBraces(container *regexp.Regexp, lines []string) []lineInfo {
+	infos := make([]lineInfo, len(lines))
+	var stack []braceBlock
+	inComment := false
+	parens := 0
+	prev := -1 // 上一个非空行
+
+	for i, line := range lines {
+		allContainers := true
+		for _, blk := range stack {
+			if !blk.container {
+				allContainers = false
+				break
+			}
+		}
+		// 以花括号开头的行属于上一条语句（签名或代码块结尾），不能作为分片起点
+		trimmed := strings.TrimSpace(line)
+		// 多行注释中的行（如以*开头的行）才算注释，注释外以*或#开头的是代码或预处理指令
+		infos[i] = lineInfo{
+			safe:    allContainers && !inComment && parens == 0 && trimmed != "" && trimmed[0] != '{' && trimmed[0] != '}',
+			comment: inComment || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "@"),
+			openers: braceOpeners(stack),
+		}
+
+		for j := 0; j < len(line); j++ {
+			ch := line[j]
+			if inComment {
+				if ch == '*' && j+1 < len(line) && line[j+1] == '/' {
+					inComment = false
+					j++
+				}
+				continue
+			}
+			switch ch {
+			case '/':
+				if j+1 < len(line) && line[j+1] == '/' {
+					j = len(line)
+				} else if j+1 < len(line) && line[j+1] == '*' {
+					inComment = true
+					j++
+				}
+			case '"', '\'', '`':
+				j = skipQuoted(line, j)
+			case '(':
+				parens++
+			case ')':
+				if parens > 0 {
+					parens--
+				}
+			case '{':
+				// 花括号单独成行时，签名在上一个非空行
+				sigLine := i
+				stmt := line[:j]
+				if strings.TrimSpace(stmt) == "" && prev >= 0 {
+					sigLine = prev
+					stmt = lines[prev] + " " + stmt
+				}
+				isContainer := container != nil && container.MatchString(stmt) && !strings.Contains(stmt, "(")
+				stack = append(stack, braceBlock{line: sigLine, container: isContainer})
+			case '}':
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+
+		if strings.TrimSpace(line) != "" {
+			prev = i
+		}
+	}
+	return infos
+}
+
+// braceOpeners 返回代码块签名所在的行
+func braceOpeners(stack []braceBlock) []int {
+	if len(stack) == 0 {
+		return nil
+	}
+	openers := make([]int, 0, len(stack))
+	for _, blk := range stack {
+		if len(openers) > 0 && openers[len(openers)-1] == blk.line {
+			continue
+		}
+		openers = append(openers, blk.line)
+	}
+	return openers
+}
+
+// skipQuoted 跳过从line[start]开始的字符串，返回结束引号的下标，没有结束引号时返回行尾
+func skipQuoted(line string, start int) int {
+	quote := line[start]
+	for j := start + 1; j < len(line); j++ {
+		if line[j] == '\\' {
+			j++
+			continue
+		}
+		if line[j] == quote {
+			return j
+		}
+	}
+	return len(line)
+}
+
+var (
+	// luaWordRe 匹配Lua标识符和关键字
+	luaWordRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	// luaLongOpenRe 匹配Lua长字符串/长注释的开始，如 [[ 或 [==[
+	luaLongOpenRe = regexp.MustCompile(`^\[(=*)\[`)
+)
+
+// analyzeLua 分析Lua代码
+// function、if、do、repeat 和 { 开启代码块，end、until 和 } 结束代码块，只在顶层允许分片
+func analyzeLua(lines []string) []lineInfo {
+	infos := make([]lineInfo, len(lines))
+	var stack []int
+	longClose := ""      // 未结束的长字符串/长注释的结束标记
+	longComment := false // 未结束的是长注释而不是长字符串
+
+	for i, line := range lines {
+		infos[i] = lineInfo{
+			safe:    len(stack) == 0 && longClose == "" && strings.TrimSpace(line) != "",
+			comment: longClose != "" && longComment || longClose == "" && strings.HasPrefix(strings.TrimSpace(line), "--"),
+			openers: luaOpeners(stack),
+		}
+
+		// 去掉字符串和注释，只保留代码
+		var code strings.Builder
+		for j := 0; j < len(line); j++ {
+			if longClose != "" {
+				if idx := strings.Index(line[j:], longClose); idx >= 0 {
+					j += idx + len(longClose) - 1
+					longClose = ""
+				} else {
+					j = len(line)
+				}
+				continue
+			}
+			rest := line[j:]
+			if strings.HasPrefix(rest, "--") {
+				if m := luaLongOpenRe.FindStringSubmatch(rest[2:]); m != nil {
+					longClose = "]" + m[1] + "]"
+					longComment = true
+					j += 1 + len(m[0])
+					continue
+				}
+				break
+			}
+			if m := luaLongOpenRe.FindStringSubmatch(rest); m != nil {
+				longClose = "]" + m[1] + "]"
+				longComment = false
+				j += len(m[0]) - 1
+				continue
+			}
+			if line[j] == '"' || line[j] == '\'' {
+				j = skipQuoted(line, j)
+				code.WriteByte(' ')
+				continue
+			}
+			code.WriteByte(line[j])
+		}
+
+		for _, tok := range luaTokens(code.String()) {
+			switch tok {
+			case "function", "if", "do", "repeat", "{":
+				stack = append(stack, i)
+			case "end", "until", "}":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+	}
+	return infos
+}
+
+// luaTokens 按出现顺序返回代码中影响代码块嵌套的关键字和花括号
+func luaTokens(code string) []string {
+	var tokens []string
+	for j := 0; j < len(code); j++ {
+		switch code[j] {
+		case '{', '}':
+			tokens = append(tokens, string(code[j]))
+			continue
+		}
+		if loc := luaWordRe.FindStringIndex(code[j:]); loc != nil && loc[0] == 0 {
+			// 标识符前面是 . 或 : 时是字段访问，如 t.end，不是关键字
+			word := code[j : j+loc[1]]
+			if j == 0 || (code[j-1] != '.' && code[j-1] != ':') {
+				tokens = append(tokens, word)
+			}
+			j += loc[1] - 1
+		}
+	}
+	return tokens
+}
+
+// luaOpeners 返回开启代码块的行，同一行开启的多个代码块只保留一次
+func luaOpeners(stack []int) []int {
+	var openers []int
+	for _, line := range stack {
+		if len(openers) > 0 && openers[len(openers)-1] == line {
+			continue
+		}
+		openers = append(openers, line)
+	}
+	return openers
+}
+
+// pyBlock Python中的一个函数或类
+type pyBlock struct {
+	indent int
+	line   int
+}
+
+// pyDefRe 匹配Python函数和类定义
+var pyDefRe = regexp.MustCompile(`^(async\s+def|def|class)\s`)
+
+// analyzePython 分析Python代码
+// 只在缩进为0、不在括号或三引号字符串内、且不紧跟在装饰器后的行允许分片
+func analyzePython(lines []string) []lineInfo {
+	infos := make([]lineInfo, len(lines))
+	var stack []pyBlock
+	triple := ""   // 未结束的三引号字符串的引号
+	parens := 0    // 未闭合的括号数
+	cont := false  // 上一行以反斜杠续行
+	decor := false // 上一个非空行是装饰器
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		stmtStart := triple == "" && parens == 0 && !cont && trimmed != "" && !strings.HasPrefix(trimmed, "#")
+
+		// 新语句的缩进回退时，结束对应的函数和类
+		if stmtStart {
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+		}
+
+		openers := make([]int, 0, len(stack))
+		for _, blk := range stack {
+			openers = append(openers, blk.line)
+		}
+		infos[i] = lineInfo{
+			safe:    stmtStart && indent == 0 && !decor,
+			comment: triple == "" && (strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "@")),
+			openers: openers,
+		}
+
+		if stmtStart && pyDefRe.MatchString(trimmed) {
+			stack = append(stack, pyBlock{indent: indent, line: i})
+		}
+
+		// 扫描引号、注释和括号
+		for j := 0; j < len(line); j++ {
+			if triple != "" {
+				if strings.HasPrefix(line[j:], triple) {
+					j += 2
+					triple = ""
+				}
+				continue
+			}
+			switch ch := line[j]; ch {
+			case '#':
+				j = len(line)
+			case '"', '\'':
+				if q := strings.Repeat(string(ch), 3); strings.HasPrefix(line[j:], q) {
+					triple = q
+					j += 2
+				} else {
+					j = skipQuoted(line, j)
+				}
+			case '(', '[', '{':
+				parens++
+			case ')', ']', '}':
+				if parens > 0 {
+					parens--
+				}
+			}
+		}
+
+		cont = triple == "" && strings.HasSuffix(strings.TrimRight(line, " \t"), "\\")
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			decor = strings.HasPrefix(trimmed, "@")
+		}
+	}
+	return infos
+}
@@ -0,0 +1,317 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// byteChunker 按字节数分片的chunker
+func byteChunker(strategy string, limit, overlap int) chunker {
+	return chunker{
+		limit:    limit,
+		measure:  func(s string) int { return len(s) },
+		strategy: strategy,
+		overlap:  overlap,
+	}
+}
+
+// checkCoverage 检查分片按顺序覆盖文件的每一行，没有缺漏，
+// 相邻分片之间恰好重叠overlap行（分片起点不早于第1行），且分片内容与行号一致
+func checkCoverage(t *testing.T, content string, chunks []codeChunk, overlap int) {
+	t.Helper()
+	lines := strings.Split(content, "\n")
+	if len(chunks) == 0 {
+		t.Fatal("no chunks")
+	}
+	if chunks[0].startLine != 1 {
+		t.Errorf("first chunk starts at line %d", chunks[0].startLine)
+	}
+	if last := chunks[len(chunks)-1].endLine; last != len(lines) {
+		t.Errorf("last chunk ends at line %d, want %d", last, len(lines))
+	}
+	for i, chunk := range chunks {
+		if want := strings.Join(lines[chunk.startLine-1:chunk.endLine], "\n"); chunk.content != want {
+			t.Errorf("chunk %d content does not match lines %d-%d", i, chunk.startLine, chunk.endLine)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := chunks[i-1]
+		wantStart := prev.endLine + 1 - overlap
+		if wantStart < 1 {
+			wantStart = 1
+		}
+		if chunk.startLine != wantStart {
+			t.Errorf("chunk %d starts at line %d after chunk ending at %d, want %d", i, chunk.startLine, prev.endLine, wantStart)
+		}
+	}
+}
+
+// goFunctions 生成n个带注释的Go函数，每个函数占5行，函数之间空一行
+func goFunctions(n int) string {
+	var b strings.Builder
+	b.WriteString("package demo\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "\n// f%d 示例函数\nfunc f%d() int {\n\tx := %d\n\treturn x\n}\n", i, i, i)
+	}
+	return b.String()
+}
+
+func TestSplitSmallFile(t *testing.T) {
+	content := "local a = 1\nlocal b = 2"
+	for _, strategy := range []string{ChunkStrategyLine, ChunkStrategySyntax} {
+		ch := byteChunker(strategy, len(content), 0)
+		chunks := ch.split("a.lua", content)
+		if len(chunks) != 1 || chunks[0].content != content || chunks[0].endLine != 2 {
+			t.Errorf("%s: chunks = %+v, want the whole file as one chunk", strategy, chunks)
+		}
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	content := goFunctions(20)
+	ch := byteChunker(ChunkStrategyLine, 100, 0)
+	chunks := ch.split("a.go", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the file split", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+
+	// 按行分片时每个分片都尽量填满：加上下一个分片的第一行就会超过上限
+	for i, chunk := range chunks {
+		if len(chunk.content) > ch.limit {
+			t.Errorf("chunk %d has %d bytes, limit %d", i, len(chunk.content), ch.limit)
+		}
+		if i+1 < len(chunks) {
+			next := strings.SplitN(chunks[i+1].content, "\n", 2)[0]
+			if len(chunk.content)+1+len(next)+1 <= ch.limit {
+				t.Errorf("chunk %d ends early at line %d", i, chunk.endLine)
+			}
+		}
+	}
+}
+
+func TestSplitSyntaxFunctionBoundaries(t *testing.T) {
+	content := goFunctions(20)
+	lines := strings.Split(content, "\n")
+	ch := byteChunker(ChunkStrategySyntax, 150, 0)
+	chunks := ch.split("a.go", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the file split", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+
+	// 除第一个分片外，每个分片都从函数前的注释开始，函数不会被拆开
+	for i, chunk := range chunks[1:] {
+		first := lines[chunk.startLine-1]
+		if !strings.HasPrefix(first, "// f") {
+			t.Errorf("chunk %d starts with %q, want a function comment", i+1, first)
+		}
+		if len(chunk.content) > ch.limit {
+			t.Errorf("chunk %d has %d bytes, limit %d", i+1, len(chunk.content), ch.limit)
+		}
+	}
+}
+
+func TestSplitSyntaxLua(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "function f%d(t)\n  if t.end then\n    return { a = %d }\n  end\nend\n", i, i)
+	}
+	content := b.String()
+	lines := strings.Split(content, "\n")
+	ch := byteChunker(ChunkStrategySyntax, 200, 0)
+	chunks := ch.split("a.lua", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the file split", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+	for i, chunk := range chunks[1:] {
+		if first := lines[chunk.startLine-1]; !strings.HasPrefix(first, "function ") {
+			t.Errorf("chunk %d starts with %q, want a function", i+1, first)
+		}
+	}
+}
+
+func TestSplitSyntaxPythonDecorator(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "@cache\ndef f%d(x):\n    return [\n        x,\n    ]\n\n", i)
+	}
+	content := b.String()
+	lines := strings.Split(content, "\n")
+	ch := byteChunker(ChunkStrategySyntax, 120, 0)
+	chunks := ch.split("a.py", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the file split", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+	for i, chunk := range chunks[1:] {
+		if first := lines[chunk.startLine-1]; first != "@cache" {
+			t.Errorf("chunk %d starts with %q, want the decorator", i+1, first)
+		}
+	}
+}
+
+func TestSplitSyntaxLongFunctionFallsBack(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("func long() {\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&b, "\tx%d := %d\n", i, i)
+	}
+	b.WriteString("}")
+	content := b.String()
+
+	ch := byteChunker(ChunkStrategySyntax, 100, 0)
+	chunks := ch.split("a.go", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the function split by lines", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+	for i, chunk := range chunks {
+		if len(chunk.content) > ch.limit {
+			t.Errorf("chunk %d has %d bytes, limit %d", i, len(chunk.content), ch.limit)
+		}
+	}
+}
+
+func TestSplitSyntaxUnknownLanguage(t *testing.T) {
+	content := goFunctions(20)
+	lineChunker := byteChunker(ChunkStrategyLine, 100, 0)
+	syntaxChunker := byteChunker(ChunkStrategySyntax, 100, 0)
+	line := lineChunker.split("a.txt", content)
+	syntax := syntaxChunker.split("a.txt", content)
+	if len(line) != len(syntax) {
+		t.Fatalf("unknown language: %d chunks by syntax, %d by line", len(syntax), len(line))
+	}
+	for i := range line {
+		if line[i].startLine != syntax[i].startLine || line[i].endLine != syntax[i].endLine {
+			t.Errorf("chunk %d: syntax %d-%d, line %d-%d", i, syntax[i].startLine, syntax[i].endLine, line[i].startLine, line[i].endLine)
+		}
+	}
+}
+
+func TestSplitOverlap(t *testing.T) {
+	content := goFunctions(20)
+	for _, strategy := range []string{ChunkStrategyLine, ChunkStrategySyntax} {
+		plainChunker := byteChunker(strategy, 150, 0)
+		overlapChunker := byteChunker(strategy, 150, 3)
+		plain := plainChunker.split("a.go", content)
+		overlapped := overlapChunker.split("a.go", content)
+		checkCoverage(t, content, overlapped, 3)
+
+		// 重叠只在分片前面补充上一个分片末尾的行，不改变分片的切分位置
+		if len(plain) != len(overlapped) {
+			t.Fatalf("%s: %d chunks with overlap, %d without", strategy, len(overlapped), len(plain))
+		}
+		for i := range plain {
+			if plain[i].endLine != overlapped[i].endLine {
+				t.Errorf("%s: chunk %d ends at %d with overlap, %d without", strategy, i, overlapped[i].endLine, plain[i].endLine)
+			}
+		}
+	}
+}
+
+func TestSplitContextHeader(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("public class Demo {\n")
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "    void m%d() {\n        run(%d);\n    }\n", i, i)
+	}
+	b.WriteString("}")
+	content := b.String()
+
+	ch := byteChunker(ChunkStrategySyntax, 120, 0)
+	ch.contextHeader = true
+	chunks := ch.split("Demo.java", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the class split between methods", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+	for i, chunk := range chunks[1:] {
+		if !strings.HasPrefix(strings.TrimSpace(chunk.content), "void m") {
+			t.Errorf("chunk %d does not start at a method: %q", i+1, chunk.content)
+		}
+		if len(chunk.header) != 1 || chunk.header[0].line != 1 || chunk.header[0].text != "public class Demo {" {
+			t.Errorf("chunk %d header = %+v, want the class signature", i+1, chunk.header)
+		}
+	}
+}
+
+func TestAnalyzeCommentLines(t *testing.T) {
+	for _, tc := range []struct {
+		lang  string
+		lines []string
+		want  []bool // 每行是否为注释
+	}{
+		{
+			// 注释外以*或#开头的是代码和预处理指令，多行注释内以*开头的才是注释
+			lang:  "c",
+			lines: []string{"#include <stdio.h>", "#define N 1", "int x = 2", "    * N;", "/*", " * f 示例", " */", "// g", "int f(int *p) {", "    *p = 0;", "}"},
+			want:  []bool{false, false, false, false, true, true, true, true, false, false, false},
+		},
+		{
+			lang:  "cpp",
+			lines: []string{"#if DEBUG", "/** doc", " * more */", "void f() {}", "#endif"},
+			want:  []bool{false, true, true, false, false},
+		},
+		{
+			lang:  "python",
+			lines: []string{"# 注释", "@cache", "def f():", `    """`, "    # 字符串中的内容", `    """`, "    return 1"},
+			want:  []bool{true, true, false, false, false, false, false},
+		},
+		{
+			lang:  "lua",
+			lines: []string{"-- 注释", "--[[", "长注释", "]]", "local s = [[", "-- 字符串", "]]"},
+			want:  []bool{true, true, true, true, false, false, false},
+		},
+	} {
+		infos := analyzeLines(tc.lang, tc.lines)
+		for i, info := range infos {
+			if info.comment != tc.want[i] {
+				t.Errorf("%s line %q: comment = %v, want %v", tc.lang, tc.lines[i], info.comment, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestFindBoundaryKeepsComments(t *testing.T) {
+	for _, tc := range []struct {
+		lang  string
+		lines []string
+		want  int // 新分片的起点
+	}{
+		// 注释与下面的函数放在一起
+		{"c", []string{"int a;", "/*", " * f", " */", "int f(void) {", "}"}, 1},
+		{"python", []string{"a = 1", "# f", "def f():", "    pass"}, 1},
+		// #define和注释外以*开头的续行留在上一个分片
+		{"c", []string{"int a;", "#define N 1", "int f(void) {", "}"}, 2},
+		{"c", []string{"int a = 1", "    * 2;", "int f(void) {", "}"}, 2},
+	} {
+		infos := analyzeLines(tc.lang, tc.lines)
+		if got := findBoundary(infos, tc.lines, 0, len(tc.lines)-1); got != tc.want {
+			t.Errorf("%s %q: boundary = %d, want %d", tc.lang, tc.lines, got, tc.want)
+		}
+	}
+}
+
+func TestSplitSyntaxCommentsPython(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "# f%d 示例函数\ndef f%d(x):\n    return [\n        x,\n    ]\n\n", i, i)
+	}
+	content := b.String()
+	lines := strings.Split(content, "\n")
+	ch := byteChunker(ChunkStrategySyntax, 120, 0)
+	chunks := ch.split("a.py", content)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want the file split", len(chunks))
+	}
+	checkCoverage(t, content, chunks, 0)
+	for i, chunk := range chunks[1:] {
+		if first := lines[chunk.startLine-1]; !strings.HasPrefix(first, "# f") {
+			t.Errorf("chunk %d starts with %q, want the comment", i+1, first)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/zx2/code-checker/pkg/fileutil"
+)
+
+// failuresFileName 失败任务清单的文件名，位于输出目录下
+const failuresFileName = "failures.json"
+
+// FailedTask 记录一个检查失败的任务
+type FailedTask struct {
+	File  string `json:"file"`           // 被检查的文件路径
+	Rule  string `json:"rule"`           // 规则名称
+	Error string `json:"error"`          // 失败原因
+	Kind  string `json:"kind,omitempty"` // 失败类别，如 content_filter、refusal、http_429
+	Time  string `json:"time"`           // 失败时间
+}
+
+// failureKey 返回任务的唯一标识
+func failureKey(file, rule string) string {
+	return file + "\x00" + rule
+}
+
+// loadFailures 读取输出目录下的失败任务清单，文件不存在时返回空列表
+func loadFailures(outputDir string) ([]FailedTask, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, failuresFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read failures file failed: %v", err)
+	}
+
+	var failures []FailedTask
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return nil, fmt.Errorf("parse failures file failed: %v", err)
+	}
+	return failures, nil
+}
+
+// saveFailures 保存失败任务清单，没有失败任务时删除清单文件
+func saveFailures(outputDir string, failures []FailedTask) error {
+	path := filepath.Join(outputDir, failuresFileName)
+	if len(failures) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove failures file failed: %v", err)
+		}
+		return nil
+	}
+
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].File != failures[j].File {
+			return failures[i].File < failures[j].File
+		}
+		return failures[i].Rule < failures[j].Rule
+	})
+
+	data, err := json.MarshalIndent(failures, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal failures failed: %v", err)
+	}
+	if err := fileutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("write failures file failed: %v", err)
+	}
+	return nil
+}
+
+// mergeFailures 合并本次运行的结果到已有的失败清单中：
+// 本次成功的任务从清单中移除，本次失败的任务覆盖旧记录，其他记录保持不变
+func mergeFailures(previous, current []FailedTask, succeeded map[string]bool) []FailedTask {
+	merged := make(map[string]FailedTask)
+	for _, f := range previous {
+		key := failureKey(f.File, f.Rule)
+		if succeeded[key] {
+			continue
+		}
+		merged[key] = f
+	}
+	for _, f := range current {
+		merged[failureKey(f.File, f.Rule)] = f
+	}
+
+	result := make([]FailedTask, 0, len(merged))
+	for _, f := range merged {
+		result = append(result, f)
+	}
+	return result
+}
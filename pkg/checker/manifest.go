@@ -0,0 +1,260 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
+	"github.com/zx2/code-checker/pkg/formatter"
+)
+
+// manifestFileName 检查清单的文件名，位于输出目录下
+const manifestFileName = "manifest.json"
+
+// manifestResultsDir 保存各条目检查结果的目录，位于输出目录下
+// 结果单独存放，避免每完成一个任务保存检查清单时重写所有结果
+const manifestResultsDir = "manifest_results"
+
+// manifestVersion 检查清单的格式版本
+const manifestVersion = 1
+
+// ManifestEntry 记录某个文件在某条规则下最近一次成功检查的信息
+type ManifestEntry struct {
+	ContentHash string `json:"content_hash"` // 文件内容的SHA-256
+	RuleHash    string `json:"rule_hash"`    // 规则名称和描述的SHA-256
+	Model       string `json:"model"`        // 使用的模型
+	Layout      string `json:"layout"`       // 报告文件的目录布局
+	CheckedAt   string `json:"checked_at"`   // 检查时间
+
+	// 保存检查结果的文件名（位于manifestResultsDir下），用于在汇总报告（json、html、sarif）中
+	// 包含之后被跳过的文件；旧版本记录的条目或保存结果失败时为空
+	ResultFile string `json:"result_file,omitempty"`
+}
+
+// runManifest 持久化的检查清单，按规则名称和相对路径索引
+// 文件内容、规则描述或模型任一发生变化时，对应的文件会被重新检查；
+// 输出布局变化时根据保存的检查结果按新布局重新生成报告
+type runManifest struct {
+	path    string
+	Version int                                 `json:"version"`
+	Rules   map[string]map[string]ManifestEntry `json:"rules"`
+}
+
+// loadManifest 读取输出目录下的检查清单，文件不存在时返回空清单
+func loadManifest(outputDir string) (*runManifest, error) {
+	m := &runManifest{
+		path:    filepath.Join(outputDir, manifestFileName),
+		Version: manifestVersion,
+		Rules:   make(map[string]map[string]ManifestEntry),
+	}
+
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("read manifest failed: %v", err)
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parse manifest failed: %v", err)
+	}
+	if m.Rules == nil {
+		m.Rules = make(map[string]map[string]ManifestEntry)
+	}
+	return m, nil
+}
+
+// upToDate 判断文件在该规则下的检查结果是否仍然有效
+// 输出布局变化时报告由保存的结果重新生成，只有没有保存结果的条目需要按新布局重新检查
+func (m *runManifest) upToDate(ruleName, relPath, contentHash, ruleHash, model, layout string) bool {
+	entry, ok := m.Rules[ruleName][relPath]
+	if !ok {
+		return false
+	}
+	if entry.Layout != layout && entry.ResultFile == "" {
+		return false
+	}
+	return entry.ContentHash == contentHash && entry.RuleHash == ruleHash && entry.Model == model
+}
+
+// record 记录一次成功的检查，并保存检查结果，检查时间取自result.CheckedAt，为空时使用当前时间
+// 保存结果失败时仍然记录该条目（之后会被跳过，但不会出现在汇总报告中），并返回错误
+func (m *runManifest) record(ruleName, relPath, contentHash, ruleHash, model, layout string, result formatter.Result) error {
+	entries, ok := m.Rules[ruleName]
+	if !ok {
+		entries = make(map[string]ManifestEntry)
+		m.Rules[ruleName] = entries
+	}
+	entry := ManifestEntry{
+		ContentHash: contentHash,
+		RuleHash:    ruleHash,
+		Model:       model,
+		Layout:      layout,
+		CheckedAt:   result.CheckedAt,
+	}
+	if entry.CheckedAt == "" {
+		entry.CheckedAt = time.Now().Format("2006-01-02 15:04:05")
+	}
+	fileName, err := m.saveResult(ruleName, relPath, result)
+	if err == nil {
+		entry.ResultFile = fileName
+	}
+	entries[relPath] = entry
+	return err
+}
+
+// saveResult 保存一个条目的检查结果，文件名由规则名称和相对路径决定
+func (m *runManifest) saveResult(ruleName, relPath string, result formatter.Result) (string, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("marshal result failed: %v", err)
+	}
+	dir := filepath.Join(filepath.Dir(m.path), manifestResultsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create result directory failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte(ruleName + "\x00" + relPath))
+	fileName := hex.EncodeToString(sum[:16]) + ".json"
+	if err := fileutil.WriteFileAtomic(filepath.Join(dir, fileName), data, 0644); err != nil {
+		return "", fmt.Errorf("write result failed: %v", err)
+	}
+	return fileName, nil
+}
+
+// loadResult 读取条目保存的检查结果
+func (m *runManifest) loadResult(entry ManifestEntry) (formatter.Result, error) {
+	var result formatter.Result
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(m.path), manifestResultsDir, entry.ResultFile))
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// previousResult 检查清单中保存的一条检查结果
+type previousResult struct {
+	rule    string
+	relPath string
+	result  formatter.Result
+}
+
+// previousResults 返回检查清单中仍然有效、但本次运行没有重新检查的结果，按规则和路径排序
+// reported记录本次已经输出结果的任务（failureKey(relPath, 规则名称)），applies判断规则是否仍适用于文件，
+// 与规划任务时的过滤一致；文件已删除，规则已不适用（后缀或关键字变化），或内容、规则、模型已变化的条目不返回；
+// 没有保存结果或结果无法读取的条目只计入missing。结果的Layout为条目记录的输出布局
+func (m *runManifest) previousResults(directory string, rules []api.Rule, model string, reported map[string]bool,
+	applies func(filePath, content string, rule api.Rule) bool) (results []previousResult, missing int) {
+	enabled := make(map[string]api.Rule)
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled[rule.Name] = rule
+		}
+	}
+
+	// 每个文件只读取一次，nil表示文件无法读取
+	type sourceFile struct{ content, hash string }
+	files := make(map[string]*sourceFile)
+	ruleNames := make([]string, 0, len(m.Rules))
+	for name := range m.Rules {
+		ruleNames = append(ruleNames, name)
+	}
+	sort.Strings(ruleNames)
+	for _, name := range ruleNames {
+		rule, ok := enabled[name]
+		if !ok {
+			continue
+		}
+		ruleHash := hashRule(rule)
+		entries := m.Rules[name]
+		paths := make([]string, 0, len(entries))
+		for relPath := range entries {
+			paths = append(paths, relPath)
+		}
+		sort.Strings(paths)
+
+		for _, relPath := range paths {
+			if reported[failureKey(relPath, name)] {
+				continue
+			}
+			entry := entries[relPath]
+			if entry.RuleHash != ruleHash || entry.Model != model {
+				continue
+			}
+			filePath := filepath.Join(directory, filepath.FromSlash(relPath))
+			file, ok := files[relPath]
+			if !ok {
+				if content, err := os.ReadFile(filePath); err == nil {
+					file = &sourceFile{content: string(content), hash: hashContent(content)}
+				}
+				files[relPath] = file
+			}
+			if file == nil || file.hash != entry.ContentHash || !applies(filePath, file.content, rule) {
+				continue
+			}
+			if entry.ResultFile == "" {
+				missing++
+				continue
+			}
+			result, err := m.loadResult(entry)
+			if err != nil {
+				missing++
+				continue
+			}
+			result.File = filePath
+			result.CheckedAt = entry.CheckedAt
+			result.Layout = entry.Layout
+			results = append(results, previousResult{rule: name, relPath: relPath, result: result})
+		}
+	}
+	return results, missing
+}
+
+// setLayout 更新条目记录的输出布局，报告按新布局重新生成后调用
+func (m *runManifest) setLayout(ruleName, relPath, layout string) {
+	if entry, ok := m.Rules[ruleName][relPath]; ok {
+		entry.Layout = layout
+		m.Rules[ruleName][relPath] = entry
+	}
+}
+
+// save 原子地保存检查清单
+func (m *runManifest) save() error {
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest failed: %v", err)
+	}
+	if err := fileutil.WriteFileAtomic(m.path, data, 0644); err != nil {
+		return fmt.Errorf("write manifest failed: %v", err)
+	}
+	return nil
+}
+
+// hashContent 计算文件内容的哈希
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashRule 计算规则的哈希，规则名称或描述变化时哈希随之变化
+func hashRule(rule api.Rule) string {
+	sum := sha256.Sum256([]byte(rule.Name + "\x00" + rule.Description))
+	return hex.EncodeToString(sum[:])
+}
+
+// relativePath 返回文件相对于检查目录的路径，统一使用/作为分隔符
+func relativePath(directory, filePath string) string {
+	rel, err := filepath.Rel(directory, filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,279 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zx2/code-checker/pkg/api"
+)
+
+// fakeClient 使用真实客户端构建请求和解析响应，只替换CallAPI：记录每次发送的请求，并按顺序返回预设的响应
+type fakeClient struct {
+	api.AIClient
+	respond  func(call int) map[string]interface{}
+	fail     func(call int) error // 可选，返回非nil时该次调用失败
+	mu       sync.Mutex
+	payloads []map[string]interface{}
+}
+
+func (f *fakeClient) CallAPI(ctx context.Context, payload map[string]interface{}, apiURL, apiKey string) (map[string]interface{}, error) {
+	f.mu.Lock()
+	f.payloads = append(f.payloads, payload)
+	call := len(f.payloads)
+	f.mu.Unlock()
+	if f.fail != nil {
+		if err := f.fail(call); err != nil {
+			return nil, err
+		}
+	}
+	return f.respond(call), nil
+}
+
+// runIncremental 在同一输出目录上运行一次检查，返回本次调用API的次数
+func runIncremental(t *testing.T, src, out string, retryFailed bool) int {
+	t.Helper()
+	return runIncrementalRules(t, src, out, []api.Rule{{Name: "r", Extensions: []string{".go"}, Enabled: true}}, retryFailed, "")
+}
+
+// runIncrementalRules 使用指定的规则和输出布局运行一次检查，返回本次调用API的次数
+func runIncrementalRules(t *testing.T, src, out string, rules []api.Rule, retryFailed bool, layout string) int {
+	t.Helper()
+	client := &fakeClient{AIClient: &api.OpenAIClient{}}
+	client.respond = func(call int) map[string]interface{} {
+		return map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{
+				"message":       map[string]interface{}{"role": "assistant", "content": "## 空指针风险\n变量可能为nil"},
+				"finish_reason": "stop",
+			}},
+		}
+	}
+	c, err := NewCodeChecker(rules, "", "", "m", 0, 100, 0, 2, nil, nil, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetFormats([]string{"markdown", "json", "html", "sarif"})
+	c.SetRetryFailed(retryFailed)
+	c.SetOutputLayout(layout)
+	if err := c.CheckDirectory(context.Background(), src, out); err != nil {
+		t.Fatal(err)
+	}
+	return len(client.payloads)
+}
+
+// jsonReportFiles 返回results.json中出现的文件
+func jsonReportFiles(t *testing.T, out string) []string {
+	t.Helper()
+	var report struct {
+		Results []struct {
+			RelPath string `json:"rel_path"`
+		} `json:"results"`
+	}
+	readJSON(t, filepath.Join(out, "results.json"), &report)
+	var files []string
+	for _, r := range report.Results {
+		files = append(files, r.RelPath)
+	}
+	return files
+}
+
+// sarifReportFiles 返回results.sarif中出现的文件
+func sarifReportFiles(t *testing.T, out string) []string {
+	t.Helper()
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	readJSON(t, filepath.Join(out, "results.sarif"), &log)
+	var files []string
+	for _, r := range log.Runs[0].Results {
+		files = append(files, r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeSource(t *testing.T, src, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAggregateReportsIncludeSkippedFiles(t *testing.T) {
+	src := t.TempDir()
+	out := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		writeSource(t, src, name, "package demo // "+name)
+	}
+	all := []string{"a.go", "b.go", "c.go"}
+
+	if calls := runIncremental(t, src, out, false); calls != 3 {
+		t.Fatalf("first run made %d calls, want 3", calls)
+	}
+
+	// 只修改了一个文件，报告仍然包含所有文件
+	writeSource(t, src, "b.go", "package demo // changed")
+	if calls := runIncremental(t, src, out, false); calls != 1 {
+		t.Fatalf("incremental run made %d calls, want 1", calls)
+	}
+	jsonFiles, sarifFiles := jsonReportFiles(t, out), sarifReportFiles(t, out)
+	if !reflect.DeepEqual(jsonFiles, all) || !reflect.DeepEqual(sarifFiles, all) {
+		t.Errorf("after incremental run: json %v, sarif %v, want %v", jsonFiles, sarifFiles, all)
+	}
+	html, err := os.ReadFile(filepath.Join(out, "report.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range all {
+		if !strings.Contains(string(html), "<summary>"+name) {
+			t.Errorf("report.html does not include %s", name)
+		}
+	}
+
+	// 重试模式下没有失败任务，报告同样包含所有文件
+	if calls := runIncremental(t, src, out, true); calls != 0 {
+		t.Fatalf("retry run made %d calls, want 0", calls)
+	}
+	jsonFiles, sarifFiles = jsonReportFiles(t, out), sarifReportFiles(t, out)
+	if !reflect.DeepEqual(jsonFiles, all) || !reflect.DeepEqual(sarifFiles, all) {
+		t.Errorf("after retry run: json %v, sarif %v, want %v", jsonFiles, sarifFiles, all)
+	}
+
+	// 删除的文件不再出现在报告中
+	if err := os.Remove(filepath.Join(src, "c.go")); err != nil {
+		t.Fatal(err)
+	}
+	runIncremental(t, src, out, false)
+	jsonFiles, sarifFiles = jsonReportFiles(t, out), sarifReportFiles(t, out)
+	if want := []string{"a.go", "b.go"}; !reflect.DeepEqual(jsonFiles, want) || !reflect.DeepEqual(sarifFiles, want) {
+		t.Errorf("after deleting c.go: json %v, sarif %v, want %v", jsonFiles, sarifFiles, want)
+	}
+}
+
+func TestRestoredResultsKeepAuthor(t *testing.T) {
+	src := t.TempDir()
+	out := t.TempDir()
+	writeSource(t, src, "a.go", "package demo")
+	runIncremental(t, src, out, false)
+
+	// 模拟检查时从svn查到的作者，恢复结果时使用保存的作者
+	m, err := loadManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.loadResult(m.Rules["r"]["a.go"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	result.Author = "alice"
+	if _, err := m.saveResult("r", "a.go", result); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := runIncremental(t, src, out, false); calls != 0 {
+		t.Fatalf("second run made %d calls, want 0", calls)
+	}
+	var report struct {
+		Results []struct {
+			Author string `json:"author"`
+		} `json:"results"`
+	}
+	readJSON(t, filepath.Join(out, "results.json"), &report)
+	if len(report.Results) != 1 || report.Results[0].Author != "alice" {
+		t.Errorf("results = %+v, want the saved author", report.Results)
+	}
+}
+
+func TestAggregateReportsDropInapplicableRules(t *testing.T) {
+	src := t.TempDir()
+	out := t.TempDir()
+	writeSource(t, src, "a.go", "package demo // TODO")
+	writeSource(t, src, "b.go", "package demo")
+	writeSource(t, src, "c.lua", "-- TODO")
+	rules := []api.Rule{{Name: "r", Extensions: []string{".go", ".lua"}, Enabled: true}}
+	if calls := runIncrementalRules(t, src, out, rules, false, ""); calls != 3 {
+		t.Fatalf("first run made %d calls, want 3", calls)
+	}
+
+	// 规则名称和描述不变，但后缀和关键字变化后不再适用的文件不会从之前的结果中恢复
+	rules[0].Extensions = []string{".go"}
+	rules[0].Keywords = []string{"TODO"}
+	if calls := runIncrementalRules(t, src, out, rules, false, ""); calls != 0 {
+		t.Fatalf("second run made %d calls, want 0", calls)
+	}
+	jsonFiles, sarifFiles := jsonReportFiles(t, out), sarifReportFiles(t, out)
+	if want := []string{"a.go"}; !reflect.DeepEqual(jsonFiles, want) || !reflect.DeepEqual(sarifFiles, want) {
+		t.Errorf("json %v, sarif %v, want %v", jsonFiles, sarifFiles, want)
+	}
+}
+
+func TestLayoutChangeRewritesMarkdownReports(t *testing.T) {
+	src := t.TempDir()
+	out := t.TempDir()
+	if err := os.Mkdir(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeSource(t, src, "sub/a.go", "package demo")
+	rules := []api.Rule{{Name: "r", Extensions: []string{".go"}, Enabled: true}}
+	if calls := runIncrementalRules(t, src, out, rules, false, ""); calls != 1 {
+		t.Fatalf("first run made %d calls, want 1", calls)
+	}
+	old, err := os.ReadFile(filepath.Join(out, "r", "a.go.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 切换布局后不重新检查，根据保存的结果按新布局生成报告，内容（包括检查时间）与之前一致
+	if calls := runIncrementalRules(t, src, out, rules, false, "mirror"); calls != 0 {
+		t.Fatalf("run after switching layout made %d calls, want 0", calls)
+	}
+	mirrored := filepath.Join(out, "r", "sub", "a.go.md")
+	data, err := os.ReadFile(mirrored)
+	if err != nil {
+		t.Fatalf("report not rewritten under the new layout: %v", err)
+	}
+	if string(data) != string(old) {
+		t.Errorf("rewritten report =\n%s\nwant\n%s", data, old)
+	}
+	if files, want := jsonReportFiles(t, out), []string{"sub/a.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("json %v, want %v", files, want)
+	}
+
+	// 检查清单已记录新布局，之后的运行不再重写报告
+	if err := os.Remove(mirrored); err != nil {
+		t.Fatal(err)
+	}
+	if calls := runIncrementalRules(t, src, out, rules, false, "mirror"); calls != 0 {
+		t.Fatalf("third run made %d calls, want 0", calls)
+	}
+	if _, err := os.Stat(mirrored); !os.IsNotExist(err) {
+		t.Errorf("report rewritten again with an unchanged layout: %v", err)
+	}
+}
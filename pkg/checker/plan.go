@@ -0,0 +1,334 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
+	"github.com/zx2/code-checker/pkg/svn"
+)
+
+// planFileName 试运行计划的文件名，位于输出目录下
+const planFileName = "plan.json"
+
+// 估算输出token数时使用的经验值：模型输出约为待审查代码的30%，且不超过max_tokens
+const (
+	outputTokenRatio    = 0.3
+	minOutputTokens     = 200
+	defaultOutputTokens = 4096 // 未配置max_tokens时的输出上限
+)
+
+// taskPlan 定义一次检查要执行的任务
+type taskPlan struct {
+	tasks   []checkTask
+	total   int // 所有文件和规则的组合数，包括被过滤和跳过的
+	skipped int // 因内容、规则、模型都未变化而跳过的任务数
+}
+
+// planTasks 遍历目录并按后缀、关键字、SVN提交时间和检查清单过滤，生成需要执行的任务
+// 重试模式下只根据失败清单生成任务
+func (c *CodeChecker) planTasks(directory string, previousFailures []FailedTask, manifest *runManifest) (*taskPlan, error) {
+	plan := &taskPlan{}
+
+	// 重试模式下只执行失败清单中的任务，不需要遍历目录
+	var files []string
+	if c.retryFailed {
+		plan.tasks = c.planRetryTasks(directory, previousFailures)
+		plan.total = len(plan.tasks)
+	} else {
+		err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk directory failed: %v", err)
+		}
+
+		fmt.Printf("找到 %d 个文件需要检查\n", len(files))
+	}
+
+	enabledRules := 0
+	for _, rule := range c.rules {
+		if rule.Enabled {
+			enabledRules++
+		}
+	}
+
+	for _, filePath := range files {
+		// 先根据文件后缀获取可能适用的规则
+		applicableRules, needContent := c.getApplicableRules(filePath)
+		if len(applicableRules) == 0 {
+			plan.total += enabledRules
+			fmt.Printf("跳过文件(后缀不匹配): %s\n", filePath)
+			continue
+		}
+
+		// 读取文件内容，用于关键字过滤和计算内容哈希
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("read file failed: %v", err)
+		}
+
+		// 如果需要检查文件内容
+		if needContent {
+			// 根据内容进一步过滤规则
+			applicableRules = c.filterRulesByContent(applicableRules, string(content))
+			if len(applicableRules) == 0 {
+				plan.total += enabledRules
+				fmt.Printf("跳过文件(关键字不匹配): %s\n", filePath)
+				continue
+			}
+		}
+
+		// 检查SVN时间过滤
+		if c.svnFilterAfter != nil {
+			if !svn.HasCommitsAfterSafe(filePath, *c.svnFilterAfter) {
+				plan.total += enabledRules
+				fmt.Printf("跳过文件(无最近提交): %s\n", filePath)
+				continue
+			}
+		}
+
+		// 为每个规则创建检查任务，内容、规则、模型和输出布局都未变化的跳过
+		relPath := relativePath(directory, filePath)
+		contentHash := hashContent(content)
+		for _, rule := range applicableRules {
+			if manifest.upToDate(rule.Name, relPath, contentHash, hashRule(rule), c.apiModel, c.outputLayout) {
+				plan.skipped++
+				plan.total++
+				fmt.Printf("跳过未变化的文件: %s - %s\n", filePath, rule.Name)
+				continue
+			}
+			plan.tasks = append(plan.tasks, checkTask{filePath: filePath, relPath: relPath, contentHash: contentHash, rule: rule})
+			plan.total++
+		}
+	}
+
+	return plan, nil
+}
+
+// DryRunPlan 试运行生成的检查计划
+type DryRunPlan struct {
+	GeneratedAt  string         `json:"generated_at"`
+	Directory    string         `json:"directory"`
+	Model        string         `json:"model"`
+	Tasks        int            `json:"tasks"`         // 需要执行的任务数（文件 + 规则）
+	Skipped      int            `json:"skipped"`       // 因未变化而跳过的任务数
+	Chunks       int            `json:"chunks"`        // 需要发送的API请求数
+	InputTokens  int            `json:"input_tokens"`  // 按当前模型估算的输入token数
+	OutputTokens int            `json:"output_tokens"` // 估算的输出token数
+	Rules        []RulePlan     `json:"rules"`
+	Estimates    []CostEstimate `json:"estimates"` // 按内置目录中的各个模型估算的费用
+	Files        []FileTaskPlan `json:"files"`
+	ruleIndex    map[string]int // 规则名称到Rules下标的索引
+	modelTokens  map[string]int // 按各模型分词器估算的输入token数
+}
+
+// RulePlan 单条规则的任务统计
+type RulePlan struct {
+	Rule         string `json:"rule"`
+	Tasks        int    `json:"tasks"`
+	Chunks       int    `json:"chunks"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+// CostEstimate 使用某个模型执行整个计划的估算费用
+// 各模型使用同一份分片结果，只按各自的分词器重新估算token数
+type CostEstimate struct {
+	Model        string  `json:"model"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	Currency     string  `json:"currency"`
+	Current      bool    `json:"current,omitempty"` // 是否为当前配置的模型
+}
+
+// FileTaskPlan 单个任务的分片和token估算
+type FileTaskPlan struct {
+	File        string `json:"file"`
+	Rule        string `json:"rule"`
+	Chunks      int    `json:"chunks"`
+	InputTokens int    `json:"input_tokens"`
+}
+
+// PlanDirectory 试运行：执行与CheckDirectory相同的任务规划和分片，
+// 估算请求数、token数和费用，输出计划并写入输出目录下的plan.json，不调用API
+func (c *CodeChecker) PlanDirectory(directory, outputDir string) (*DryRunPlan, error) {
+	previousFailures, err := loadFailures(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := loadManifest(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := c.planTasks(directory, previousFailures, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	models := api.Models()
+	result := &DryRunPlan{
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Directory:   directory,
+		Model:       c.apiModel,
+		Tasks:       len(plan.tasks),
+		Skipped:     plan.skipped,
+		ruleIndex:   make(map[string]int),
+		modelTokens: make(map[string]int),
+	}
+
+	countTokens := api.TokenCounter(c.apiModel)
+	structured := c.apiClient.StructuredOutput()
+	overheads := make(map[string]int) // 规则名称+模型 -> 提示词token数
+	overhead := func(model string, rule api.Rule) int {
+		key := rule.Name + "\x00" + model
+		if n, ok := overheads[key]; ok {
+			return n
+		}
+		n := api.PromptOverheadTokens(model, []api.Rule{rule}, structured, c.lineNumbers)
+		overheads[key] = n
+		return n
+	}
+
+	for _, task := range plan.tasks {
+		content, err := os.ReadFile(task.filePath)
+		if err != nil {
+			return nil, fmt.Errorf("read file failed: %v", err)
+		}
+		chunks := c.splitCodeContent(task.filePath, string(content), task.rule)
+
+		inputTokens, outputTokens := 0, 0
+		for _, chunk := range chunks {
+			text := chunk.text(c.lineNumbers)
+			codeTokens := countTokens(text)
+			inputTokens += overhead(c.apiModel, task.rule) + codeTokens
+			outputTokens += c.estimateOutputTokens(codeTokens)
+			for _, info := range models {
+				result.modelTokens[info.Name] += overhead(info.Name, task.rule) + info.EstimateTokens(text)
+			}
+		}
+
+		result.addTask(task, len(chunks), inputTokens, outputTokens)
+	}
+
+	// 各模型的输出token数差别不大，统一使用当前模型的估算值
+	for _, info := range models {
+		input := result.modelTokens[info.Name]
+		result.Estimates = append(result.Estimates, CostEstimate{
+			Model:        info.Name,
+			InputTokens:  input,
+			OutputTokens: result.OutputTokens,
+			Cost:         info.Cost(input, result.OutputTokens),
+			Currency:     info.Currency,
+		})
+	}
+	if current, ok := api.LookupModel(c.apiModel); ok {
+		for i := range result.Estimates {
+			if result.Estimates[i].Model == current.Name {
+				result.Estimates[i].Current = true
+			}
+		}
+	}
+	sort.SliceStable(result.Estimates, func(i, j int) bool {
+		a, b := result.Estimates[i], result.Estimates[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.Cost < b.Cost
+	})
+
+	result.print()
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal plan failed: %v", err)
+	}
+	planFile := filepath.Join(outputDir, planFileName)
+	if err := fileutil.WriteFileAtomic(planFile, data, 0644); err != nil {
+		return nil, fmt.Errorf("write plan failed: %v", err)
+	}
+	fmt.Printf("检查计划已写入: %s\n", planFile)
+
+	return result, nil
+}
+
+// estimateOutputTokens 估算单个分片的输出token数
+func (c *CodeChecker) estimateOutputTokens(codeTokens int) int {
+	limit := c.maxTokens
+	if limit <= 0 {
+		limit = defaultOutputTokens
+	}
+	n := int(float64(codeTokens) * outputTokenRatio)
+	if n < minOutputTokens {
+		n = minOutputTokens
+	}
+	if n > limit {
+		n = limit
+	}
+	return n
+}
+
+// addTask 将一个任务计入计划
+func (p *DryRunPlan) addTask(task checkTask, chunks, inputTokens, outputTokens int) {
+	idx, ok := p.ruleIndex[task.rule.Name]
+	if !ok {
+		idx = len(p.Rules)
+		p.ruleIndex[task.rule.Name] = idx
+		p.Rules = append(p.Rules, RulePlan{Rule: task.rule.Name})
+	}
+	rule := &p.Rules[idx]
+	rule.Tasks++
+	rule.Chunks += chunks
+	rule.InputTokens += inputTokens
+	rule.OutputTokens += outputTokens
+
+	p.Chunks += chunks
+	p.InputTokens += inputTokens
+	p.OutputTokens += outputTokens
+
+	p.Files = append(p.Files, FileTaskPlan{
+		File:        task.relPath,
+		Rule:        task.rule.Name,
+		Chunks:      chunks,
+		InputTokens: inputTokens,
+	})
+}
+
+// print 输出计划摘要
+func (p *DryRunPlan) print() {
+	fmt.Printf("\n===== 检查计划（试运行，未调用API） =====\n")
+	fmt.Printf("任务数: %d（跳过未变化的任务 %d 个），API请求数: %d\n", p.Tasks, p.Skipped, p.Chunks)
+	fmt.Printf("估算token数（%s）: 输入 %d，输出 %d\n\n", p.Model, p.InputTokens, p.OutputTokens)
+
+	fmt.Printf("%-24s %8s %8s %12s %12s\n", "规则", "任务", "请求", "输入tokens", "输出tokens")
+	for _, rule := range p.Rules {
+		fmt.Printf("%-24s %8d %8d %12d %12d\n", rule.Rule, rule.Tasks, rule.Chunks, rule.InputTokens, rule.OutputTokens)
+	}
+
+	fmt.Printf("\n按模型估算的费用（价格仅供参考）:\n")
+	fmt.Printf("%-28s %12s %12s %12s\n", "模型", "输入tokens", "输出tokens", "费用")
+	for _, e := range p.Estimates {
+		marker := ""
+		if e.Current {
+			marker = "  <- 当前模型"
+		}
+		fmt.Printf("%-28s %12d %12d %10.4f %s%s\n", e.Model, e.InputTokens, e.OutputTokens, e.Cost, e.Currency, marker)
+	}
+	if _, ok := api.LookupModel(p.Model); !ok {
+		fmt.Printf("当前模型 %s 不在内置模型目录中，无法估算费用\n", p.Model)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,270 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
+	"github.com/zx2/code-checker/pkg/svn"
+)
+
+// 统计报告的文件名，位于输出目录下
+const (
+	statsJSONFileName     = "stats.json"
+	statsMarkdownFileName = "stats.md"
+)
+
+// callRecord 一次API调用的统计信息
+type callRecord struct {
+	filePath     string
+	rule         string
+	model        string // 响应中的模型名称，没有时为配置的模型
+	usage        api.Usage
+	estimated    bool // 服务未返回usage，用量为估算值
+	latency      time.Duration
+	attempts     int
+	finishReason string
+}
+
+// runStats 收集本次运行所有API调用的统计信息，可被多个worker并发使用
+type runStats struct {
+	mu      sync.Mutex
+	records []callRecord
+}
+
+// add 记录一次API调用
+func (s *runStats) add(record callRecord) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+}
+
+// StatsGroup 按某个维度汇总的API调用统计
+type StatsGroup struct {
+	Name             string             `json:"name"`
+	Calls            int                `json:"calls"`             // API调用次数（分片数）
+	Files            int                `json:"files"`             // 涉及的文件数
+	PromptTokens     int                `json:"prompt_tokens"`     // 输入token数
+	CompletionTokens int                `json:"completion_tokens"` // 输出token数
+	TotalTokens      int                `json:"total_tokens"`      // 总token数
+	Cost             map[string]float64 `json:"cost"`              // 按币种汇总的估算费用，模型不在内置目录中时不计入
+	AvgLatencyMs     int64              `json:"avg_latency_ms"`    // 平均耗时，包括重试
+	MaxLatencyMs     int64              `json:"max_latency_ms"`    // 最长耗时
+	Retries          int                `json:"retries"`           // 重试次数
+	EstimatedCalls   int                `json:"estimated_calls"`   // 服务未返回usage、按估算值计入的调用次数
+	FinishReasons    map[string]int     `json:"finish_reasons"`    // 各结束原因的次数，如 stop、length
+	files            map[string]bool
+	latency          time.Duration
+}
+
+// RunStats 本次运行的统计报告
+type RunStats struct {
+	GeneratedAt string       `json:"generated_at"`
+	DurationSec float64      `json:"duration_sec"` // 本次运行的总耗时（秒）
+	Total       StatsGroup   `json:"total"`
+	ByRule      []StatsGroup `json:"by_rule"`
+	ByAuthor    []StatsGroup `json:"by_author"`
+	ByExtension []StatsGroup `json:"by_extension"`
+	ByModel     []StatsGroup `json:"by_model"`
+}
+
+// add 将一次调用计入分组
+func (g *StatsGroup) add(record callRecord) {
+	if g.files == nil {
+		g.files = make(map[string]bool)
+		g.Cost = make(map[string]float64)
+		g.FinishReasons = make(map[string]int)
+	}
+	g.Calls++
+	g.files[record.filePath] = true
+	g.Files = len(g.files)
+	g.PromptTokens += record.usage.PromptTokens
+	g.CompletionTokens += record.usage.CompletionTokens
+	g.TotalTokens += record.usage.TotalTokens
+	if info, ok := api.LookupModel(record.model); ok {
+		g.Cost[info.Currency] += info.Cost(record.usage.PromptTokens, record.usage.CompletionTokens)
+	}
+	g.latency += record.latency
+	g.AvgLatencyMs = (g.latency / time.Duration(g.Calls)).Milliseconds()
+	if ms := record.latency.Milliseconds(); ms > g.MaxLatencyMs {
+		g.MaxLatencyMs = ms
+	}
+	if record.attempts > 1 {
+		g.Retries += record.attempts - 1
+	}
+	if record.estimated {
+		g.EstimatedCalls++
+	}
+	reason := record.finishReason
+	if reason == "" {
+		reason = "unknown"
+	}
+	g.FinishReasons[reason]++
+}
+
+// build 按规则、作者、文件后缀和模型汇总统计信息
+func (s *runStats) build(duration time.Duration, svnLogLimit int, svnPriorityAuthors []string) *RunStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &RunStats{
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		DurationSec: duration.Seconds(),
+		Total:       StatsGroup{Name: "总计"},
+	}
+
+	authors := make(map[string]string) // 文件路径 -> 主要作者，避免重复调用svn
+	byRule := make(map[string]*StatsGroup)
+	byAuthor := make(map[string]*StatsGroup)
+	byExt := make(map[string]*StatsGroup)
+	byModel := make(map[string]*StatsGroup)
+	addTo := func(groups map[string]*StatsGroup, name string, record callRecord) {
+		g, ok := groups[name]
+		if !ok {
+			g = &StatsGroup{Name: name}
+			groups[name] = g
+		}
+		g.add(record)
+	}
+
+	for _, record := range s.records {
+		author, ok := authors[record.filePath]
+		if !ok {
+			author = svn.GetFileAuthorSafe(record.filePath, svnLogLimit, svnPriorityAuthors)
+			if author == "" {
+				author = "(未知)"
+			}
+			authors[record.filePath] = author
+		}
+		ext := strings.ToLower(filepath.Ext(record.filePath))
+		if ext == "" {
+			ext = "(无后缀)"
+		}
+
+		result.Total.add(record)
+		addTo(byRule, record.rule, record)
+		addTo(byAuthor, author, record)
+		addTo(byExt, ext, record)
+		addTo(byModel, record.model, record)
+	}
+
+	result.ByRule = sortedGroups(byRule)
+	result.ByAuthor = sortedGroups(byAuthor)
+	result.ByExtension = sortedGroups(byExt)
+	result.ByModel = sortedGroups(byModel)
+	return result
+}
+
+// sortedGroups 按token用量从高到低排列分组
+func sortedGroups(groups map[string]*StatsGroup) []StatsGroup {
+	list := make([]StatsGroup, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TotalTokens != list[j].TotalTokens {
+			return list[i].TotalTokens > list[j].TotalTokens
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// writeStats 将统计报告写入输出目录，失败时只打印警告
+func (c *CodeChecker) writeStats(outputDir string, duration time.Duration) {
+	if c.stats == nil {
+		return
+	}
+	stats := c.stats.build(duration, c.svnLogLimit, c.svnPriorityAuthors)
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		fmt.Printf("警告: 生成统计报告失败: %v\n", err)
+		return
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(outputDir, statsJSONFileName), data, 0644); err != nil {
+		fmt.Printf("警告: 保存统计报告失败: %v\n", err)
+		return
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(outputDir, statsMarkdownFileName), []byte(stats.markdown()), 0644); err != nil {
+		fmt.Printf("警告: 保存统计报告失败: %v\n", err)
+		return
+	}
+	fmt.Printf("统计报告已生成: %s\n", filepath.Join(outputDir, statsMarkdownFileName))
+}
+
+// markdown 将统计报告渲染为Markdown表格
+func (s *RunStats) markdown() string {
+	var b strings.Builder
+	b.WriteString("# 检查统计\n\n")
+	b.WriteString(fmt.Sprintf("生成时间：%s\n\n", s.GeneratedAt))
+	b.WriteString(fmt.Sprintf("总耗时：%v，API调用 %d 次，涉及 %d 个文件，重试 %d 次\n\n",
+		time.Duration(s.DurationSec*float64(time.Second)).Round(time.Second), s.Total.Calls, s.Total.Files, s.Total.Retries))
+	b.WriteString(fmt.Sprintf("token用量：%d（输入 %d，输出 %d），估算费用：%s\n\n",
+		s.Total.TotalTokens, s.Total.PromptTokens, s.Total.CompletionTokens, formatCost(s.Total.Cost)))
+	if s.Total.EstimatedCalls > 0 {
+		b.WriteString(fmt.Sprintf("其中 %d 次调用服务未返回用量，按估算值计入。\n\n", s.Total.EstimatedCalls))
+	}
+
+	sections := []struct {
+		title  string
+		groups []StatsGroup
+	}{
+		{"按规则", s.ByRule},
+		{"按作者", s.ByAuthor},
+		{"按文件后缀", s.ByExtension},
+		{"按模型", s.ByModel},
+	}
+	for _, section := range sections {
+		b.WriteString(fmt.Sprintf("## %s\n\n", section.title))
+		b.WriteString("| 名称 | 调用 | 文件 | 输入tokens | 输出tokens | 估算费用 | 平均耗时 | 最长耗时 | 重试 | 结束原因 |\n")
+		b.WriteString("|------|------|------|------------|------------|----------|----------|----------|------|----------|\n")
+		for _, g := range section.groups {
+			b.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d | %s | %dms | %dms | %d | %s |\n",
+				strings.ReplaceAll(g.Name, "|", "\\|"), g.Calls, g.Files, g.PromptTokens, g.CompletionTokens,
+				formatCost(g.Cost), g.AvgLatencyMs, g.MaxLatencyMs, g.Retries, formatFinishReasons(g.FinishReasons)))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatCost 格式化按币种汇总的费用，如 "0.1234 USD"
+func formatCost(cost map[string]float64) string {
+	if len(cost) == 0 {
+		return "-"
+	}
+	currencies := make([]string, 0, len(cost))
+	for currency := range cost {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	parts := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		parts = append(parts, fmt.Sprintf("%.4f %s", cost[currency], currency))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// formatFinishReasons 格式化结束原因的次数，如 "stop: 10, length: 2"
+func formatFinishReasons(reasons map[string]int) string {
+	names := make([]string, 0, len(reasons))
+	for name := range reasons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, reasons[name]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -4,21 +4,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/checker"
+	"github.com/zx2/code-checker/pkg/formatter"
 )
 
 // Config 定义配置文件结构
 type Config struct {
 	// API配置
 	API struct {
-		Type          string `json:"type"`            // API类型：siliconflow 或 openai
-		URL           string `json:"url"`             // API服务地址
-		Key           string `json:"key"`             // API密钥
-		Model         string `json:"model"`           // API使用的模型
-		MaxTokens     int    `json:"max_tokens"`      // API返回的最大token数
-		EnableLog     bool   `json:"enable_log"`      // 是否启用API请求日志
-		MaxTextLength int    `json:"max_text_length"` // 单次请求最大文本长度
+		Type           string `json:"type"`             // API类型：siliconflow 或 openai
+		URL            string `json:"url"`              // API服务地址
+		Key            string `json:"key"`              // API密钥
+		Model          string `json:"model"`            // API使用的模型
+		MaxTokens      int    `json:"max_tokens"`       // API返回的最大token数
+		EnableLog      bool   `json:"enable_log"`       // 是否启用API请求日志
+		MaxTextLength  int    `json:"max_text_length"`  // 单次请求最大文本长度（字节数），0表示按模型上下文窗口自动计算
+		MaxChunkTokens int    `json:"max_chunk_tokens"` // 单个分片的最大token数，优先于max_text_length
+		Timeout        int    `json:"timeout"`          // 单次HTTP请求超时时间（秒），流式响应的服务为空闲超时
+		ContextWindow  int    `json:"context_window"`   // 模型的上下文窗口（tokens），用于计算分片大小，ollama同时用作options.num_ctx
+
+		StructuredOutput bool `json:"structured_output"` // 是否要求模型以JSON格式返回结构化的问题列表
+		PromptCache      bool `json:"prompt_cache"`      // 是否为各请求共享的提示词前缀添加缓存标记（目前只对anthropic生效）
+
+		MaxContinuations int `json:"max_continuations"` // 回复因max_tokens被截断时最多续写的次数，默认2，-1表示不续写
+
+		RPM int `json:"rpm"` // 每分钟最多请求数，所有并发任务共享，0表示不限制
+		TPM int `json:"tpm"` // 每分钟最多token数（按估算值），所有并发任务共享，0表示不限制
+
+		Retry api.RetryPolicy `json:"retry"` // API调用失败时的重试策略
+
+		// 鉴权配置，不配置时使用服务商默认的鉴权方式（通常为api.key）
+		Auth struct {
+			Type      string `json:"type"`       // 鉴权方式：volc_sign（火山引擎AK/SK换取方舟API Key）
+			AccessKey string `json:"access_key"` // Access Key ID
+			SecretKey string `json:"secret_key"` // Secret Access Key
+			Region    string `json:"region"`     // 地域，默认cn-beijing
+		} `json:"auth"`
+
+		// Azure OpenAI配置，用于替换url中的{resource}、{deployment}和{api_version}
+		Azure struct {
+			Resource   string `json:"resource"`    // 资源名称，即 https://<resource>.openai.azure.com
+			Deployment string `json:"deployment"`  // 部署名称，默认与model相同
+			APIVersion string `json:"api_version"` // API版本
+		} `json:"azure"`
 	} `json:"api"`
 
 	// 检查配置
@@ -26,8 +57,21 @@ type Config struct {
 		Directory   string `json:"directory"`   // 要检查的目录路径
 		OutputDir   string `json:"output_dir"`  // 检查结果输出目录
 		Concurrency int    `json:"concurrency"` // 并发检查任务数量
+		RunTimeout  int    `json:"run_timeout"` // 整次检查的最长运行时间（分钟），0表示不限制
+
+		OutputLayout    string   `json:"output_layout"`     // 报告文件的目录布局：basename、mirror 或 flat
+		LineNumbers     bool     `json:"line_numbers"`      // 发送给API的代码是否带有行号前缀，便于问题定位到具体行
+		ChunkStrategy   string   `json:"chunk_strategy"`    // 大文件分片策略：syntax（按函数/类边界）或 line（按行）
+		ChunkOverlap    int      `json:"chunk_overlap"`     // 相邻分片之间重叠的行数，0表示不重叠
+		ChunkContext    bool     `json:"chunk_context"`     // 分片从函数/类内部开始时，是否在前面附上外层签名作为上下文
+		Formats         []string `json:"formats"`           // 同时输出的报告格式，如 ["markdown", "json", "html"]
+		ShutdownGrace   int      `json:"shutdown_grace"`    // 中断后等待进行中任务完成的最长时间（秒）
+		ContinueOnError bool     `json:"continue_on_error"` // 单个任务失败时是否继续检查，失败任务记录到输出目录的failures.json
 	} `json:"check"`
 
+	// 预算配置，达到任一上限后停止派发新任务
+	Budget checker.Budget `json:"budget"`
+
 	// SVN配置
 	SVN struct {
 		LogLimit        int      `json:"log_limit"`        // SVN日志获取的最大记录数
@@ -39,6 +83,9 @@ type Config struct {
 	Rules []api.Rule `json:"rules"` // 检查规则列表
 }
 
+// AuthVolcSign 使用火山引擎Access Key/Secret Key签名申请方舟推理接入点的API Key
+const AuthVolcSign = "volc_sign"
+
 // LoadConfig 从文件加载配置
 func LoadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
@@ -59,52 +106,148 @@ func LoadConfig(filename string) (*Config, error) {
 	return &config, nil
 }
 
-// validate 验证配置是否完整
-func (c *Config) validate() error {
-	if c.API.URL == "" {
-		return fmt.Errorf("缺少API URL配置")
+// expandURL 替换url中的占位符：模型在URL路径中的服务（如gemini）用{model}，
+// Azure OpenAI用{resource}、{deployment}和{api_version}
+func (c *Config) expandURL() error {
+	azure := &c.API.Azure
+	if azure.Deployment == "" {
+		azure.Deployment = c.API.Model
+	}
+	if azure.APIVersion == "" {
+		azure.APIVersion = api.AzureDefaultAPIVersion
 	}
-	if c.API.Key == "" {
-		return fmt.Errorf("缺少API Key配置")
+	if strings.Contains(c.API.URL, "{resource}") && azure.Resource == "" {
+		return fmt.Errorf("缺少api.azure.resource配置")
 	}
+
+	c.API.URL = strings.NewReplacer(
+		"{model}", c.API.Model,
+		"{resource}", azure.Resource,
+		"{deployment}", azure.Deployment,
+		"{api_version}", azure.APIVersion,
+	).Replace(c.API.URL)
+	return nil
+}
+
+// validate 验证配置是否完整
+func (c *Config) validate() error {
 	if c.Check.Directory == "" {
 		return fmt.Errorf("缺少检查目录配置")
 	}
 	if c.API.Type == "" {
 		c.API.Type = "siliconflow" // 默认使用siliconflow
 	}
-	if c.API.Model == "" {
-		switch c.API.Type {
-		case "aihubmix":
-			c.API.Model = "gpt-3.5-turbo" // AiHubMix默认模型
-		case "volcengine":
-			c.API.Model = "doubao-1.5-pro-32k" // 火山引擎默认模型
-		default:
-			c.API.Model = "Pro/deepseek-ai/DeepSeek-R1" // 其他默认模型
+
+	// URL、模型和max_tokens未配置时使用服务提供商的默认值
+	provider, ok := api.LookupProvider(c.API.Type)
+	if !ok {
+		return fmt.Errorf("不支持的API类型: %s (可选: %s)", c.API.Type, strings.Join(api.ProviderNames(), ", "))
+	}
+	if c.API.URL == "" {
+		c.API.URL = provider.DefaultURL
+	}
+	if c.API.URL == "" {
+		return fmt.Errorf("缺少API URL配置")
+	}
+	switch c.API.Auth.Type {
+	case "":
+		if c.API.Key == "" && provider.KeyRequired {
+			return fmt.Errorf("缺少API Key配置")
+		}
+	case AuthVolcSign:
+		// 申请到的是方舟的API Key，替换其他服务商自己的鉴权方式后无法访问
+		if provider.Name != "volcengine" {
+			return fmt.Errorf("volc_sign鉴权只能用于volcengine类型，当前类型: %s", c.API.Type)
 		}
+		if c.API.Auth.AccessKey == "" || c.API.Auth.SecretKey == "" {
+			return fmt.Errorf("volc_sign鉴权需要配置access_key和secret_key")
+		}
+	default:
+		return fmt.Errorf("不支持的鉴权方式: %s (可选: %s)", c.API.Auth.Type, AuthVolcSign)
+	}
+	if c.API.Model == "" {
+		c.API.Model = c.API.Azure.Deployment // Azure OpenAI的模型即部署名称
+	}
+	if c.API.Model == "" {
+		c.API.Model = provider.DefaultModel
+	}
+	if c.API.Model == "" {
+		return fmt.Errorf("缺少API模型配置")
+	}
+	if c.API.Auth.Type == AuthVolcSign && !strings.HasPrefix(c.API.Model, "ep-") {
+		return fmt.Errorf("volc_sign鉴权需要将model配置为推理接入点ID（ep-开头）: %s", c.API.Model)
 	}
 	if c.API.MaxTokens <= 0 {
-		switch c.API.Type {
-		case "aihubmix":
-			c.API.MaxTokens = 60000 // AiHubMix默认max_tokens
-		case "volcengine":
-			c.API.MaxTokens = 8192 // 火山引擎默认max_tokens
-		default:
-			c.API.MaxTokens = 8192 // 其他API默认max_tokens
-		}
+		c.API.MaxTokens = provider.DefaultMaxTokens
+	}
+	if err := c.expandURL(); err != nil {
+		return err
 	}
 	if c.Check.OutputDir == "" {
 		c.Check.OutputDir = "check_results" // 默认输出目录
 	}
-	if c.API.MaxTextLength <= 0 {
-		c.API.MaxTextLength = 4000 // 默认最大文本长度为4000字符
+	if c.Check.OutputLayout == "" {
+		c.Check.OutputLayout = formatter.LayoutBasename // 默认按文件名输出，与旧版本保持一致
+	}
+	if !formatter.ValidLayout(c.Check.OutputLayout) {
+		return fmt.Errorf("不支持的输出布局: %s", c.Check.OutputLayout)
+	}
+	if c.Check.ChunkStrategy == "" {
+		c.Check.ChunkStrategy = checker.ChunkStrategyLine // 默认按行分片，与旧版本保持一致
+	}
+	if c.Check.ChunkStrategy != checker.ChunkStrategySyntax && c.Check.ChunkStrategy != checker.ChunkStrategyLine {
+		return fmt.Errorf("不支持的分片策略: %s", c.Check.ChunkStrategy)
+	}
+	if c.Check.ChunkOverlap < 0 {
+		return fmt.Errorf("chunk_overlap不能为负数: %d", c.Check.ChunkOverlap)
+	}
+	if len(c.Check.Formats) == 0 {
+		c.Check.Formats = []string{"markdown"} // 默认只输出Markdown报告
+	}
+	for _, name := range c.Check.Formats {
+		if !formatter.Has(name) {
+			return fmt.Errorf("不支持的报告格式: %s (可选: %s)", name, strings.Join(formatter.Names(), ", "))
+		}
+	}
+	if c.API.RPM < 0 || c.API.TPM < 0 {
+		return fmt.Errorf("rpm和tpm不能为负数")
+	}
+	if c.API.MaxTextLength < 0 || c.API.MaxChunkTokens < 0 {
+		return fmt.Errorf("max_text_length和max_chunk_tokens不能为负数")
+	}
+	if c.API.MaxContinuations == 0 {
+		c.API.MaxContinuations = 2 // 默认最多续写2次
+	}
+	if c.API.MaxContinuations < -1 {
+		return fmt.Errorf("max_continuations只能为-1或非负数: %d", c.API.MaxContinuations)
+	}
+	if c.API.Timeout <= 0 {
+		c.API.Timeout = provider.DefaultTimeout
+	}
+	if c.API.Timeout <= 0 {
+		c.API.Timeout = 300 // 默认单次请求超时5分钟
+	}
+	if c.API.ContextWindow < 0 {
+		return fmt.Errorf("context_window不能为负数: %d", c.API.ContextWindow)
+	}
+	if c.API.ContextWindow == 0 {
+		c.API.ContextWindow = provider.DefaultContext
+	}
+	if c.Budget.MaxTokens < 0 || c.Budget.MaxCost < 0 || c.Budget.MaxMinutes < 0 {
+		return fmt.Errorf("budget中的上限不能为负数")
 	}
 	if c.SVN.LogLimit <= 0 {
 		c.SVN.LogLimit = 30 // 默认获取最近30条SVN日志
 	}
+	if c.Check.Concurrency <= 0 {
+		c.Check.Concurrency = provider.DefaultConcurrency
+	}
 	if c.Check.Concurrency <= 0 {
 		c.Check.Concurrency = 3 // 默认并发数为3
 	}
+	if c.Check.ShutdownGrace <= 0 {
+		c.Check.ShutdownGrace = 60 // 默认中断后最多等待60秒
+	}
 
 	return nil
 }
@@ -0,0 +1,131 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zx2/code-checker/pkg/api"
+)
+
+// Formatter 定义检查结果输出接口
+type Formatter interface {
+	AddResult(result Result) error
+	Close() error
+}
+
+// Restorer 由把所有结果汇总到一个报告文件中的格式化器实现（json、html、sarif）
+// 断点续检跳过的任务没有重新检查，通过RestoreResult把之前保存的结果加入报告，
+// 使报告始终包含所有检查结果仍然有效的文件，而不只是本次运行检查的文件；
+// Markdown格式化器也实现该接口，在输出布局变化时按新布局重新生成报告
+type Restorer interface {
+	RestoreResult(result Result) error
+}
+
+// Options 定义创建格式化器所需的参数
+type Options struct {
+	OutputDir          string     // 检查结果输出目录
+	SourceDir          string     // 被检查的源代码目录
+	Layout             string     // 报告文件的目录布局
+	SVNLogLimit        int        // SVN日志获取的最大记录数
+	SVNPriorityAuthors []string   // 优先级作者列表
+	Rules              []api.Rule // 检查规则，用于在报告中描述规则
+}
+
+// Factory 定义格式化器的构造函数
+type Factory func(opts Options) (Formatter, error)
+
+// registry 已注册的格式化器
+var registry = make(map[string]Factory)
+
+// Register 注册格式化器，重复注册同名格式化器会覆盖之前的注册
+func Register(name string, factory Factory) {
+	registry[strings.ToLower(name)] = factory
+}
+
+// Has 判断是否存在指定名称的格式化器
+func Has(name string) bool {
+	_, ok := registry[strings.ToLower(name)]
+	return ok
+}
+
+// Names 返回所有已注册的格式化器名称
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 根据名称创建格式化器
+func New(name string, opts Options) (Formatter, error) {
+	factory, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown formatter: %s (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(opts)
+}
+
+// NewMulti 根据名称列表创建同时输出多种格式的格式化器
+func NewMulti(names []string, opts Options) (Formatter, error) {
+	var formatters []Formatter
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		f, err := New(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		formatters = append(formatters, f)
+	}
+
+	if len(formatters) == 1 {
+		return formatters[0], nil
+	}
+	return &multiFormatter{formatters: formatters}, nil
+}
+
+// multiFormatter 将结果同时分发给多个格式化器
+type multiFormatter struct {
+	formatters []Formatter
+}
+
+// AddResult 添加检查结果到所有格式化器
+func (m *multiFormatter) AddResult(result Result) error {
+	for _, f := range m.formatters {
+		if err := f.AddResult(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreResult 将之前保存的结果加入所有汇总报告的格式化器
+func (m *multiFormatter) RestoreResult(result Result) error {
+	for _, f := range m.formatters {
+		if r, ok := f.(Restorer); ok {
+			if err := r.RestoreResult(result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close 关闭所有格式化器，返回遇到的第一个错误
+func (m *multiFormatter) Close() error {
+	var firstErr error
+	for _, f := range m.formatters {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
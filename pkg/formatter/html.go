@@ -0,0 +1,152 @@
+package formatter
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
+)
+
+// htmlFileName HTML报告的文件名，位于输出目录下
+const htmlFileName = "report.html"
+
+func init() {
+	Register("html", func(opts Options) (Formatter, error) {
+		return NewHTMLFormatter(opts), nil
+	})
+}
+
+// htmlTemplate HTML报告模板
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"severity": api.SeverityLabel,
+	"location": FindingLocation,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>代码检查报告</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "Microsoft YaHei", sans-serif; margin: 2em; color: #24292f; }
+h1 { border-bottom: 1px solid #d0d7de; padding-bottom: .3em; }
+h2 { margin-top: 2em; }
+details { border: 1px solid #d0d7de; border-radius: 6px; margin: .5em 0; padding: .5em 1em; }
+summary { cursor: pointer; font-weight: 600; }
+.meta { color: #57606a; font-size: .9em; margin: .5em 0; }
+pre { white-space: pre-wrap; word-wrap: break-word; background: #f6f8fa; padding: 1em; border-radius: 6px; }
+</style>
+</head>
+<body>
+<h1>代码检查报告</h1>
+<p class="meta">生成时间：{{.GeneratedAt}}　源代码目录：{{.SourceDir}}　结果数：{{.Total}}</p>
+{{range .Rules}}
+<h2>{{.Name}}（{{len .Entries}}）</h2>
+{{range $entry := .Entries}}
+<details>
+<summary>{{.RelPath}}{{if .Truncated}}　⚠️ 回复被截断{{end}}</summary>
+<p class="meta">{{if .Author}}主要作者：{{.Author}}　{{end}}检查时间：{{.CheckedAt}}</p>
+{{if .Findings}}<ul>
+{{range .Findings}}<li>[{{severity .Severity}}] <code>{{location $entry.RelPath .}}</code> {{.Title}}</li>
+{{end}}</ul>{{end}}
+<pre>{{.Result}}</pre>
+</details>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// htmlRule HTML报告中按规则分组的结果
+type htmlRule struct {
+	Name    string
+	Entries []jsonEntry
+}
+
+// HTMLFormatter 实现HTML格式的结果输出，关闭时将所有结果（包括恢复的之前的结果）写入report.html
+type HTMLFormatter struct {
+	opts  Options
+	rules map[string]*htmlRule
+	total int
+}
+
+// NewHTMLFormatter 创建新的HTML格式化器
+func NewHTMLFormatter(opts Options) *HTMLFormatter {
+	return &HTMLFormatter{
+		opts:  opts,
+		rules: make(map[string]*htmlRule),
+	}
+}
+
+// AddResult 添加检查结果
+func (f *HTMLFormatter) AddResult(result Result) error {
+	if len(result.AppliedRules) == 0 {
+		return nil
+	}
+	f.add(result, fileAuthor(result, f.opts.SVNLogLimit, f.opts.SVNPriorityAuthors))
+	return nil
+}
+
+// RestoreResult 加入之前保存的结果，实现Restorer
+// 作者使用检查时保存的结果中记录的作者，不再查询svn
+func (f *HTMLFormatter) RestoreResult(result Result) error {
+	if len(result.AppliedRules) > 0 {
+		f.add(result, result.Author)
+	}
+	return nil
+}
+
+// add 加入一条结果
+func (f *HTMLFormatter) add(result Result, author string) {
+	entry := jsonEntry{
+		File:         result.File,
+		RelPath:      relPath(f.opts.SourceDir, result.File),
+		Author:       author,
+		AppliedRules: result.AppliedRules,
+		Findings:     result.Findings,
+		Truncated:    result.Truncated,
+		Result:       result.Result,
+		CheckedAt:    checkedAt(result),
+	}
+	for _, ruleName := range result.AppliedRules {
+		rule, ok := f.rules[ruleName]
+		if !ok {
+			rule = &htmlRule{Name: ruleName}
+			f.rules[ruleName] = rule
+		}
+		rule.Entries = append(rule.Entries, entry)
+	}
+	f.total++
+}
+
+// Close 写入HTML报告
+func (f *HTMLFormatter) Close() error {
+	var rules []*htmlRule
+	for _, rule := range f.rules {
+		sort.Slice(rule.Entries, func(i, j int) bool {
+			return rule.Entries[i].RelPath < rule.Entries[j].RelPath
+		})
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
+
+	var buf bytes.Buffer
+	err := htmlTemplate.Execute(&buf, map[string]interface{}{
+		"GeneratedAt": time.Now().Format("2006-01-02 15:04:05"),
+		"SourceDir":   f.opts.SourceDir,
+		"Total":       f.total,
+		"Rules":       rules,
+	})
+	if err != nil {
+		return fmt.Errorf("render html report failed: %v", err)
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(f.opts.OutputDir, htmlFileName), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write html report failed: %v", err)
+	}
+	return nil
+}
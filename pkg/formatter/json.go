@@ -0,0 +1,128 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
+)
+
+// jsonFileName JSON报告的文件名，位于输出目录下
+const jsonFileName = "results.json"
+
+func init() {
+	Register("json", func(opts Options) (Formatter, error) {
+		return NewJSONFormatter(opts), nil
+	})
+}
+
+// jsonEntry 定义JSON报告中的单条检查结果
+type jsonEntry struct {
+	File         string        `json:"file"`
+	RelPath      string        `json:"rel_path"`
+	Author       string        `json:"author,omitempty"`
+	AppliedRules []string      `json:"applied_rules"`
+	Findings     []api.Finding `json:"findings"`
+	Truncated    []LineRange   `json:"truncated,omitempty"` // AI回复因长度限制被截断的分片
+	Result       string        `json:"result"`
+	CheckedAt    string        `json:"checked_at"`
+}
+
+// jsonReport 定义JSON报告的整体结构
+type jsonReport struct {
+	GeneratedAt string      `json:"generated_at"`
+	SourceDir   string      `json:"source_dir"`
+	Results     []jsonEntry `json:"results"`
+}
+
+// JSONFormatter 实现JSON格式的结果输出，关闭时将所有结果（包括恢复的之前的结果）按文件排序写入results.json
+type JSONFormatter struct {
+	opts    Options
+	entries []jsonEntry
+}
+
+// NewJSONFormatter 创建新的JSON格式化器
+func NewJSONFormatter(opts Options) *JSONFormatter {
+	return &JSONFormatter{opts: opts}
+}
+
+// AddResult 添加检查结果
+func (f *JSONFormatter) AddResult(result Result) error {
+	if len(result.AppliedRules) == 0 {
+		return nil
+	}
+	f.add(result, fileAuthor(result, f.opts.SVNLogLimit, f.opts.SVNPriorityAuthors))
+	return nil
+}
+
+// RestoreResult 加入之前保存的结果，实现Restorer
+// 作者使用检查时保存的结果中记录的作者，不再查询svn
+func (f *JSONFormatter) RestoreResult(result Result) error {
+	if len(result.AppliedRules) > 0 {
+		f.add(result, result.Author)
+	}
+	return nil
+}
+
+// add 加入一条结果
+func (f *JSONFormatter) add(result Result, author string) {
+	findings := result.Findings
+	if findings == nil {
+		findings = []api.Finding{}
+	}
+	f.entries = append(f.entries, jsonEntry{
+		File:         result.File,
+		RelPath:      relPath(f.opts.SourceDir, result.File),
+		Author:       author,
+		AppliedRules: result.AppliedRules,
+		Findings:     findings,
+		Truncated:    result.Truncated,
+		Result:       result.Result,
+		CheckedAt:    checkedAt(result),
+	})
+}
+
+// Close 写入JSON报告
+func (f *JSONFormatter) Close() error {
+	sort.SliceStable(f.entries, func(i, j int) bool {
+		return f.entries[i].RelPath < f.entries[j].RelPath
+	})
+	report := jsonReport{
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		SourceDir:   f.opts.SourceDir,
+		Results:     f.entries,
+	}
+	if report.Results == nil {
+		report.Results = []jsonEntry{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal json report failed: %v", err)
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(f.opts.OutputDir, jsonFileName), data, 0644); err != nil {
+		return fmt.Errorf("write json report failed: %v", err)
+	}
+	return nil
+}
+
+// checkedAt 返回结果的检查时间，本次检查的结果使用当前时间
+func checkedAt(result Result) string {
+	if result.CheckedAt != "" {
+		return result.CheckedAt
+	}
+	return time.Now().Format("2006-01-02 15:04:05")
+}
+
+// relPath 返回文件相对于源代码目录的路径，统一使用/作为分隔符
+func relPath(sourceDir, filePath string) string {
+	rel, err := filepath.Rel(sourceDir, filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -5,36 +5,109 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"time"
+	"strings"
 
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
 	"github.com/zx2/code-checker/pkg/svn"
 )
 
 // Result 定义检查结果结构
 type Result struct {
-	File         string   `json:"file"`
-	Result       string   `json:"result"`
-	AppliedRules []string `json:"applied_rules"`
+	File         string        `json:"file"`
+	Result       string        `json:"result"`
+	AppliedRules []string      `json:"applied_rules"`
+	Findings     []api.Finding `json:"findings,omitempty"`
+	Chunks       []LineRange   `json:"chunks,omitempty"`    // 每个分片对应的行号范围
+	Truncated    []LineRange   `json:"truncated,omitempty"` // AI回复因长度限制被截断的分片
+	Author       string        `json:"author,omitempty"`    // 文件的主要作者，为空时由格式化器查询svn
+	CheckedAt    string        `json:"-"`                   // 检查时间，为空表示本次检查
+	Layout       string        `json:"-"`                   // 之前保存的结果生成报告时的目录布局，只用于RestoreResult
+}
+
+// LineRange 定义文件中的行号范围
+type LineRange struct {
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+}
+
+// 报告文件的目录布局
+const (
+	LayoutBasename = "basename" // 规则目录下直接使用文件名，不同目录的同名文件会互相覆盖
+	LayoutMirror   = "mirror"   // 在规则目录下镜像源代码目录结构
+	LayoutFlat     = "flat"     // 规则目录下平铺，文件名包含用__连接的相对路径
+)
+
+// ValidLayout 判断布局名称是否有效
+func ValidLayout(layout string) bool {
+	switch layout {
+	case LayoutBasename, LayoutMirror, LayoutFlat:
+		return true
+	}
+	return false
+}
+
+func init() {
+	Register("markdown", func(opts Options) (Formatter, error) {
+		return NewMarkdownFormatter(opts.OutputDir, opts.SourceDir, opts.Layout, opts.SVNLogLimit, opts.SVNPriorityAuthors), nil
+	})
 }
 
 // MarkdownFormatter 实现Markdown格式的结果输出
 type MarkdownFormatter struct {
 	outputDir          string
+	sourceDir          string
+	layout             string
 	ruleDirs           map[string]string
 	svnLogLimit        int
 	svnPriorityAuthors []string
 }
 
 // NewMarkdownFormatter 创建新的Markdown格式化器
-func NewMarkdownFormatter(outputDir string, svnLogLimit int, svnPriorityAuthors []string) *MarkdownFormatter {
+func NewMarkdownFormatter(outputDir, sourceDir, layout string, svnLogLimit int, svnPriorityAuthors []string) *MarkdownFormatter {
+	if layout == "" {
+		layout = LayoutBasename
+	}
 	return &MarkdownFormatter{
 		outputDir:          outputDir,
+		sourceDir:          sourceDir,
+		layout:             layout,
 		ruleDirs:           make(map[string]string),
 		svnLogLimit:        svnLogLimit,
 		svnPriorityAuthors: svnPriorityAuthors,
 	}
 }
 
+// reportLocation 根据布局返回报告所在的子目录（相对于规则目录）和不带作者前缀的文件名
+func (f *MarkdownFormatter) reportLocation(filePath string) (subDir, fileName string) {
+	fileName = filepath.Base(filePath)
+	if f.layout == LayoutBasename {
+		return "", fileName
+	}
+
+	rel, err := filepath.Rel(f.sourceDir, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// 不在检查目录下的文件退回到按文件名输出
+		return "", fileName
+	}
+	rel = filepath.ToSlash(rel)
+
+	if f.layout == LayoutFlat {
+		return "", strings.ReplaceAll(rel, "/", "__")
+	}
+
+	// mirror布局：目录部分逐级清理特殊字符后作为子目录
+	dir := filepath.Dir(filepath.FromSlash(rel))
+	if dir == "." {
+		return "", fileName
+	}
+	parts := strings.Split(filepath.ToSlash(dir), "/")
+	for i, part := range parts {
+		parts[i] = f.generateSafeFileName(part)
+	}
+	return filepath.Join(parts...), fileName
+}
+
 // generateSafeFileName 生成安全的文件名（不带作者前缀）
 func (f *MarkdownFormatter) generateSafeFileName(fileName string) string {
 	// 只替换Windows不允许的特殊字符，保留中文等其他字符
@@ -43,12 +116,10 @@ func (f *MarkdownFormatter) generateSafeFileName(fileName string) string {
 }
 
 // generateFileNameWithAuthor 生成带作者前缀的文件名
-func (f *MarkdownFormatter) generateFileNameWithAuthor(filePath, fileName string) string {
+func (f *MarkdownFormatter) generateFileNameWithAuthor(author, fileName string) string {
 	// 生成基础安全文件名
 	safeFileName := f.generateSafeFileName(fileName)
 
-	// 获取文件的主要作者
-	author := svn.GetFileAuthorSafe(filePath, f.svnLogLimit, f.svnPriorityAuthors)
 	if author != "" {
 		// 清理作者名中的特殊字符
 		safeAuthor := regexp.MustCompile(`[<>:"/\\|?*]`).ReplaceAllString(author, "_")
@@ -68,6 +139,9 @@ func (f *MarkdownFormatter) AddResult(result Result) error {
 		return nil
 	}
 
+	// 获取文件的主要作者，用于文件名前缀和显示
+	author := fileAuthor(result, f.svnLogLimit, f.svnPriorityAuthors)
+
 	for _, ruleName := range result.AppliedRules {
 		// 只替换Windows不允许的特殊字符: < > : " / \ | ? *
 		// 保留中文等其他字符
@@ -80,32 +154,22 @@ func (f *MarkdownFormatter) AddResult(result Result) error {
 
 		f.ruleDirs[ruleName] = ruleDir
 
-		// 生成文件的检查结果文件
-		fileName := filepath.Base(result.File)
+		// 根据布局生成检查结果文件的位置
+		subDir, fileName := f.reportLocation(result.File)
 		// 生成带作者前缀的文件名
-		finalFileName := f.generateFileNameWithAuthor(result.File, fileName)
-		resultFile := filepath.Join(ruleDir, finalFileName+".md")
+		finalFileName := f.generateFileNameWithAuthor(author, fileName)
+		resultFile := filepath.Join(ruleDir, subDir, finalFileName+".md")
 
-		// 写入检查结果
-		file, err := os.Create(resultFile)
-		if err != nil {
-			return fmt.Errorf("create result file failed: %v", err)
-		}
-		defer file.Close()
-
-		currentTime := time.Now().Format("2006-01-02 15:04:05")
-
-		// 获取作者信息用于显示
-		author := svn.GetFileAuthorSafe(result.File, f.svnLogLimit, f.svnPriorityAuthors)
 		authorInfo := ""
 		if author != "" {
 			authorInfo = fmt.Sprintf("主要作者：%s\n", author)
 		}
 
-		content := fmt.Sprintf("# 文件检查结果：%s\n\n检查时间：%s\n%s\n%s\n\n",
-			result.File, currentTime, authorInfo, result.Result)
+		content := fmt.Sprintf("# 文件检查结果：%s\n\n检查时间：%s\n%s\n%s%s%s\n\n",
+			result.File, checkedAt(result), authorInfo, truncatedNotice(result), f.findingsOverview(result), result.Result)
 
-		if _, err := file.WriteString(content); err != nil {
+		// 先写临时文件再重命名，避免中断时留下写了一半的报告
+		if err := fileutil.WriteFileAtomic(resultFile, []byte(content), 0644); err != nil {
 			return fmt.Errorf("write result file failed: %v", err)
 		}
 	}
@@ -113,6 +177,64 @@ func (f *MarkdownFormatter) AddResult(result Result) error {
 	return nil
 }
 
+// fileAuthor 返回文件的主要作者，结果中没有记录作者时查询svn
+func fileAuthor(result Result, svnLogLimit int, svnPriorityAuthors []string) string {
+	if result.Author != "" {
+		return result.Author
+	}
+	return svn.GetFileAuthorSafe(result.File, svnLogLimit, svnPriorityAuthors)
+}
+
+// RestoreResult 处理之前保存的结果，实现Restorer
+// 报告文件已在之前的运行中写入，只有输出布局变化时才根据保存的结果按新布局重新生成，不需要重新检查
+func (f *MarkdownFormatter) RestoreResult(result Result) error {
+	if result.Layout == f.layout {
+		return nil
+	}
+	return f.AddResult(result)
+}
+
+// truncatedNotice 生成AI回复被截断的提示，没有被截断的分片时返回空字符串
+func truncatedNotice(result Result) string {
+	if len(result.Truncated) == 0 {
+		return ""
+	}
+	ranges := make([]string, 0, len(result.Truncated))
+	for _, r := range result.Truncated {
+		ranges = append(ranges, fmt.Sprintf("第%d-%d行", r.StartLine, r.EndLine))
+	}
+	return fmt.Sprintf("> ⚠️ 以下部分的AI回复因长度限制被截断，结果可能不完整：%s\n\n", strings.Join(ranges, "、"))
+}
+
+// findingsOverview 生成问题概览表，列出每个问题的级别和 文件:行号 位置
+func (f *MarkdownFormatter) findingsOverview(result Result) string {
+	if len(result.Findings) == 0 {
+		return ""
+	}
+
+	path := relPath(f.sourceDir, result.File)
+	var b strings.Builder
+	b.WriteString("| 级别 | 位置 | 问题 |\n|------|------|------|\n")
+	for _, finding := range result.Findings {
+		title := strings.ReplaceAll(finding.Title, "|", "\\|")
+		b.WriteString(fmt.Sprintf("| %s | `%s` | %s |\n", api.SeverityLabel(finding.Severity), FindingLocation(path, finding), title))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// FindingLocation 返回问题的位置描述，如 "client/main.lua:12" 或 "client/main.lua:12-15"
+func FindingLocation(path string, finding api.Finding) string {
+	switch {
+	case finding.StartLine <= 0:
+		return path
+	case finding.EndLine > finding.StartLine:
+		return fmt.Sprintf("%s:%d-%d", path, finding.StartLine, finding.EndLine)
+	default:
+		return fmt.Sprintf("%s:%d", path, finding.StartLine)
+	}
+}
+
 // Close 关闭格式化器
 func (f *MarkdownFormatter) Close() error {
 	// Markdown格式化器不需要特殊的关闭操作
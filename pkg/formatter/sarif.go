@@ -0,0 +1,232 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/zx2/code-checker/pkg/api"
+	"github.com/zx2/code-checker/pkg/fileutil"
+)
+
+// sarifFileName SARIF报告的文件名，位于输出目录下
+const sarifFileName = "results.sarif"
+
+func init() {
+	Register("sarif", func(opts Options) (Formatter, error) {
+		return NewSARIFFormatter(opts), nil
+	})
+}
+
+// 以下类型对应SARIF 2.1.0规范中用到的部分字段
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string                     `json:"name"`
+	InformationURI string                     `json:"informationUri,omitempty"`
+	Rules          []sarifReportingDescriptor `json:"rules"`
+}
+
+type sarifReportingDescriptor struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+}
+
+type sarifMessage struct {
+	Text     string `json:"text"`
+	Markdown string `json:"markdown,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// SARIFFormatter 实现SARIF 2.1.0格式的结果输出，关闭时写入results.sarif
+// 报告包含恢复的之前的结果，CI按报告关闭告警时不会误关断点续检跳过的文件中的问题
+// 每条规则对应一个reportingDescriptor，每个发现的问题(Finding)对应一个result
+type SARIFFormatter struct {
+	opts      Options
+	ruleIndex map[string]int
+	rules     []sarifReportingDescriptor
+	results   []sarifResult
+}
+
+// NewSARIFFormatter 创建新的SARIF格式化器
+func NewSARIFFormatter(opts Options) *SARIFFormatter {
+	f := &SARIFFormatter{
+		opts:      opts,
+		ruleIndex: make(map[string]int),
+	}
+	for _, rule := range opts.Rules {
+		f.addRule(rule.Name, rule.Description)
+	}
+	return f
+}
+
+// addRule 注册规则，返回规则在rules中的下标
+func (f *SARIFFormatter) addRule(name, description string) int {
+	if idx, ok := f.ruleIndex[name]; ok {
+		return idx
+	}
+	if description == "" {
+		description = name
+	}
+	f.rules = append(f.rules, sarifReportingDescriptor{
+		ID:               name,
+		Name:             name,
+		ShortDescription: sarifMessage{Text: name},
+		FullDescription:  sarifMessage{Text: description},
+	})
+	f.ruleIndex[name] = len(f.rules) - 1
+	return len(f.rules) - 1
+}
+
+// AddResult 添加检查结果
+func (f *SARIFFormatter) AddResult(result Result) error {
+	if len(result.AppliedRules) == 0 {
+		return nil
+	}
+
+	uri := relPath(f.opts.SourceDir, result.File)
+	for _, ruleName := range result.AppliedRules {
+		idx := f.addRule(ruleName, "")
+		for _, finding := range result.Findings {
+			location := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: uri, URIBaseID: "SRCROOT"},
+				},
+			}
+			if finding.StartLine > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.StartLine, EndLine: finding.EndLine}
+			}
+			f.results = append(f.results, sarifResult{
+				RuleID:    ruleName,
+				RuleIndex: idx,
+				Level:     sarifLevel(finding.Severity),
+				Message:   sarifMessage{Text: finding.Title, Markdown: sarifMarkdown(finding)},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+	return nil
+}
+
+// RestoreResult 加入之前保存的结果，实现Restorer
+func (f *SARIFFormatter) RestoreResult(result Result) error {
+	return f.AddResult(result)
+}
+
+// Close 写入SARIF报告
+func (f *SARIFFormatter) Close() error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "code-checker",
+			InformationURI: "https://github.com/gns333/AICodeChecker",
+			Rules:          f.rules,
+		}},
+		Results: f.results,
+	}
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifReportingDescriptor{}
+	}
+	if run.Results == nil {
+		run.Results = []sarifResult{}
+	}
+	if abs, err := filepath.Abs(f.opts.SourceDir); err == nil {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{
+			"SRCROOT": {URI: fileURI(abs)},
+		}
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	data, err := json.MarshalIndent(log, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal sarif report failed: %v", err)
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(f.opts.OutputDir, sarifFileName), data, 0644); err != nil {
+		return fmt.Errorf("write sarif report failed: %v", err)
+	}
+	return nil
+}
+
+// fileURI 将绝对目录路径转换为以/结尾的file URI
+func fileURI(dir string) string {
+	p := filepath.ToSlash(dir)
+	if !strings.HasPrefix(p, "/") {
+		// Windows路径，如 C:/code
+		p = "/" + p
+	}
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// sarifLevel 将问题的严重级别映射为SARIF的level
+func sarifLevel(severity string) string {
+	switch severity {
+	case api.SeverityHigh:
+		return "error"
+	case api.SeverityLow, api.SeverityInfo:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// sarifMarkdown 生成问题的Markdown描述
+func sarifMarkdown(f api.Finding) string {
+	text := f.Description
+	if f.Suggestion != "" {
+		text += "\n\n> " + strings.ReplaceAll(f.Suggestion, "\n", "\n> ")
+	}
+	if f.FixedCode != "" {
+		text += "\n\n```\n" + f.FixedCode + "\n```"
+	}
+	return strings.TrimSpace(text)
+}